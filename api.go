@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// apiFormat is how an API version writes errors, tickers and charts
+type apiFormat struct {
+	error  func(c echo.Context, status int, message string) error
+	ticker func(row TickerTable) any
+	chart  func(symbol string, data *ChartData) any
+}
+
+// legacyAPI is the unversioned API with plain text errors and Go field names
+var legacyAPI = apiFormat{
+	error: func(c echo.Context, status int, message string) error {
+		return c.String(status, message)
+	},
+	ticker: func(row TickerTable) any {
+		return row
+	},
+	chart: func(symbol string, data *ChartData) any {
+		return data
+	},
+}
+
+// parseChartQuery reads the from and to times, RFC 3339 or dates, the comma separated fields and the limit
+func parseChartQuery(c echo.Context) (ChartQuery, error) {
+	q := ChartQuery{}
+	// Dates are whole days in New York time, so to includes the day's candle
+	parseTime := func(name string, endOfDay bool) (time.Time, error) {
+		value := c.QueryParam(name)
+		if value == "" {
+			return time.Time{}, nil
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t, nil
+		}
+		if t, err := time.ParseInLocation(time.DateOnly, value, marketLocation); err == nil {
+			if endOfDay {
+				t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+			}
+			return t, nil
+		}
+		return time.Time{}, fmt.Errorf("Invalid %s: %s", name, value)
+	}
+	var err error
+	if q.From, err = parseTime("from", false); err != nil {
+		return q, err
+	}
+	if q.To, err = parseTime("to", true); err != nil {
+		return q, err
+	}
+	for _, field := range splitList(c.QueryParam("fields")) {
+		field = strings.ToLower(field)
+		if field == "timestamp" {
+			continue
+		}
+		if !slices.Contains(chartFields, field) {
+			return q, fmt.Errorf("Unknown field: %s", field)
+		}
+		q.Fields = append(q.Fields, field)
+	}
+	// Only timestamps were asked for
+	if c.QueryParam("fields") != "" && len(q.Fields) == 0 {
+		q.Fields = []string{"timestamp"}
+	}
+	if limit := c.QueryParam("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil || q.Limit <= 0 {
+			return q, fmt.Errorf("Invalid limit: %s", limit)
+		}
+	}
+	return q, nil
+}
+
+// etagMatch reports whether the If-None-Match header lists the ETag
+func etagMatch(header string, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == etag || v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// chartHandler serves the selected chart data, or 304 Not Modified when the client has the latest
+func chartHandler(f apiFormat, storage *Storage) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		symbol := strings.ToUpper(c.Param("symbol"))
+		q, err := parseChartQuery(c)
+		if err != nil {
+			return f.error(c, http.StatusBadRequest, err.Error())
+		}
+		etag, ok := storage.GetChartETag(symbol)
+		if !ok {
+			return f.error(c, http.StatusNotFound, "Unknown symbol")
+		}
+		// Representations differ by query, caches key them by URL
+		c.Response().Header().Set(echo.HeaderCacheControl, "no-cache")
+		c.Response().Header().Set("ETag", etag)
+		if etagMatch(c.Request().Header.Get("If-None-Match"), etag) {
+			return c.NoContent(http.StatusNotModified)
+		}
+		data := storage.GetChartRange(symbol, q)
+		if data == nil {
+			return f.error(c, http.StatusNotFound, "Unknown symbol")
+		}
+		return c.JSON(http.StatusOK, f.chart(symbol, data))
+	}
+}
+
+// tickerRequest is the body of ticker changes, updates need BuyPrice or MutedUntil
+type tickerRequest struct {
+	Symbol     string       `json:"symbol"`
+	BuyPrice   *float64     `json:"buyPrice"`
+	MutedUntil optionalTime `json:"mutedUntil"`
+}
+
+// optionalTime tells an absent time from null, which unmutes
+type optionalTime struct {
+	set  bool
+	time *time.Time
+}
+
+func (o *optionalTime) UnmarshalJSON(buf []byte) error {
+	o.set = true
+	if string(buf) == "null" {
+		o.time = nil
+		return nil
+	}
+	o.time = &time.Time{}
+	return json.Unmarshal(buf, o.time)
+}
+
+// mute applies MutedUntil to the room's ticker, if it was given
+func (r *tickerRequest) mute(storage *Storage, room string, symbol string) error {
+	if !r.MutedUntil.set {
+		return nil
+	}
+	if r.MutedUntil.time == nil {
+		return storage.Unmute(room, symbol)
+	}
+	return storage.Mute(room, symbol, *r.MutedUntil.time)
+}
+
+func (r *tickerRequest) buyPrice() float64 {
+	if r.BuyPrice == nil {
+		return 0
+	}
+	return *r.BuyPrice
+}
+
+func (r *tickerRequest) validBuyPrice() bool {
+	return r.BuyPrice == nil || (*r.BuyPrice >= 0 && !math.IsInf(*r.BuyPrice, 0))
+}
+
+// registerWatchlistAPI adds the routes managing the default room's watchlist, which the web UI shows.
+// Other rooms' watchlists are managed in chat.
+func registerWatchlistAPI(g *echo.Group, f apiFormat, ctx context.Context, storage *Storage, fetcher *Fetcher, live *Live, webhooks *Webhooks) {
+	create := func(c echo.Context) error {
+		req := tickerRequest{}
+		if err := c.Bind(&req); err != nil {
+			return f.error(c, http.StatusBadRequest, "Invalid request body")
+		}
+		symbol := strings.ToUpper(req.Symbol)
+		if !symbolPattern.MatchString(symbol) {
+			return f.error(c, http.StatusBadRequest, "Invalid symbol")
+		}
+		if !req.validBuyPrice() {
+			return f.error(c, http.StatusBadRequest, "Invalid buy price")
+		}
+		if storage.IsWatched(DEFAULT_ROOM, symbol) {
+			return f.error(c, http.StatusConflict, "Ticker already exists")
+		}
+		err := watchTicker(ctx, storage, fetcher, live, webhooks, DEFAULT_ROOM, symbol, req.buyPrice())
+		var fetchErr *FetchError
+		switch {
+		case errors.Is(err, errNoCandles):
+			return f.error(c, http.StatusUnprocessableEntity, err.Error())
+		case errors.As(err, &fetchErr):
+			return f.error(c, http.StatusBadGateway, err.Error())
+		case err != nil:
+			return f.error(c, http.StatusInternalServerError, err.Error())
+		}
+		if err := req.mute(storage, DEFAULT_ROOM, symbol); err != nil {
+			return f.error(c, http.StatusInternalServerError, err.Error())
+		}
+		c.Response().Header().Set(echo.HeaderLocation, strings.TrimSuffix(c.Request().URL.Path, "/")+"/"+symbol)
+		row, _ := storage.GetRoomTickerRow(DEFAULT_ROOM, symbol)
+		return c.JSON(http.StatusCreated, f.ticker(row))
+	}
+	update := func(c echo.Context) error {
+		symbol := strings.ToUpper(c.Param("symbol"))
+		req := tickerRequest{}
+		if err := c.Bind(&req); err != nil {
+			return f.error(c, http.StatusBadRequest, "Invalid request body")
+		}
+		if req.BuyPrice == nil && !req.MutedUntil.set {
+			return f.error(c, http.StatusBadRequest, "No buy price or mutedUntil")
+		}
+		if !req.validBuyPrice() {
+			return f.error(c, http.StatusBadRequest, "Invalid buy price")
+		}
+		if !storage.IsWatched(DEFAULT_ROOM, symbol) {
+			return f.error(c, http.StatusNotFound, "Unknown symbol")
+		}
+		if req.BuyPrice != nil {
+			if _, err := storage.Watch(DEFAULT_ROOM, symbol, req.buyPrice()); err != nil {
+				return f.error(c, http.StatusInternalServerError, err.Error())
+			}
+			publishCandle(live, storage, symbol)
+			sendFill(webhooks, storage, DEFAULT_ROOM, symbol)
+		}
+		if err := req.mute(storage, DEFAULT_ROOM, symbol); err != nil {
+			return f.error(c, http.StatusInternalServerError, err.Error())
+		}
+		row, _ := storage.GetRoomTickerRow(DEFAULT_ROOM, symbol)
+		return c.JSON(http.StatusOK, f.ticker(row))
+	}
+	remove := func(c echo.Context) error {
+		symbol := strings.ToUpper(c.Param("symbol"))
+		if !storage.IsWatched(DEFAULT_ROOM, symbol) {
+			return f.error(c, http.StatusNotFound, "Unknown symbol")
+		}
+		if err := unwatchTicker(storage, fetcher, live, DEFAULT_ROOM, symbol); err != nil {
+			return f.error(c, http.StatusInternalServerError, err.Error())
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+	g.POST("/tickers", create)
+	g.POST("/tickers/", create)
+	g.PUT("/tickers/:symbol", update)
+	g.DELETE("/tickers/:symbol", remove)
+}
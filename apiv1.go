@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const API_V1 = "/api/v1"
+
+//go:embed openapi.json
+var openapiV1 []byte
+
+// number is a float that marshals NaN and infinities as null, which JSON cannot represent
+type number float64
+
+func (n number) MarshalJSON() ([]byte, error) {
+	if math.IsNaN(float64(n)) || math.IsInf(float64(n), 0) {
+		return []byte("null"), nil
+	}
+	return json.Marshal(float64(n))
+}
+
+// indicatorV1 pads the series to n values, with null outside the defined range, e.g. before there is enough data
+func indicatorV1(values []float64, defined definedRange, n int) []number {
+	if values == nil {
+		return nil
+	}
+	ret := make([]number, n)
+	for i := range ret {
+		ret[i] = number(math.NaN())
+		if i >= defined.from && i < defined.to && i < len(values) {
+			ret[i] = number(values[i])
+		}
+	}
+	return ret
+}
+
+// orNull returns null for zero, i.e. no buy price
+func orNull(v float64) number {
+	if v == 0 {
+		return number(math.NaN())
+	}
+	return number(v)
+}
+
+func signalV1(signal Signal) string {
+	if signal == SignalHold {
+		return "hold"
+	}
+	return string(signal)
+}
+
+type ErrorV1 struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+type ErrorResponseV1 struct {
+	Error ErrorV1 `json:"error"`
+}
+
+type TickerV1 struct {
+	Symbol     string     `json:"symbol"`
+	BuyPrice   number     `json:"buyPrice"`
+	Close      number     `json:"close"`
+	Change     number     `json:"change"`
+	Signal     string     `json:"signal"`
+	MutedUntil *time.Time `json:"mutedUntil"` // Of the configured room
+}
+
+func newTickerV1(row TickerTable) TickerV1 {
+	change := number(row.Change)
+	if row.BuyPrice == 0 {
+		change = number(math.NaN())
+	}
+	return TickerV1{
+		Symbol:     row.Symbol,
+		BuyPrice:   orNull(row.BuyPrice),
+		Close:      number(row.Close),
+		Change:     change,
+		Signal:     signalV1(row.Signal),
+		MutedUntil: row.MutedUntil,
+	}
+}
+
+type ChartV1 struct {
+	Symbol    string      `json:"symbol"`
+	BuyPrice  number      `json:"buyPrice"`
+	Timestamp []time.Time `json:"timestamp"`
+	Open      []float64   `json:"open"`
+	High      []float64   `json:"high"`
+	Low       []float64   `json:"low"`
+	Close     []float64   `json:"close"`
+	BBH       []number    `json:"bbh"`
+	BBM       []number    `json:"bbm"`
+	BBL       []number    `json:"bbl"`
+	StochK    []number    `json:"stochK"`
+	StochD    []number    `json:"stochD"`
+	MFI       []number    `json:"mfi"`
+	SMA       []number    `json:"sma"`
+	ADX       []number    `json:"adx"`
+}
+
+func newChartV1(symbol string, data *ChartData) ChartV1 {
+	n := len(data.Timestamp)
+	return ChartV1{
+		Symbol:    symbol,
+		BuyPrice:  orNull(data.BuyPrice),
+		Timestamp: data.Timestamp,
+		Open:      data.Open,
+		High:      data.High,
+		Low:       data.Low,
+		Close:     data.Close,
+		BBH:       indicatorV1(data.BBH, data.defined["bbh"], n),
+		BBM:       indicatorV1(data.BBM, data.defined["bbm"], n),
+		BBL:       indicatorV1(data.BBL, data.defined["bbl"], n),
+		StochK:    indicatorV1(data.StochK, data.defined["stochk"], n),
+		StochD:    indicatorV1(data.StochD, data.defined["stochd"], n),
+		MFI:       indicatorV1(data.MFI, data.defined["mfi"], n),
+		SMA:       indicatorV1(data.SMA, data.defined["sma"], n),
+		ADX:       indicatorV1(data.ADX, data.defined["adx"], n),
+	}
+}
+
+// CandleV1 is one entry of every ChartV1 series
+type CandleV1 struct {
+	Timestamp time.Time `json:"timestamp"`
+	Open      float64   `json:"open"`
+	High      float64   `json:"high"`
+	Low       float64   `json:"low"`
+	Close     float64   `json:"close"`
+	BBH       number    `json:"bbh"`
+	BBM       number    `json:"bbm"`
+	BBL       number    `json:"bbl"`
+	StochK    number    `json:"stochK"`
+	StochD    number    `json:"stochD"`
+	MFI       number    `json:"mfi"`
+	SMA       number    `json:"sma"`
+	ADX       number    `json:"adx"`
+}
+
+func newCandleV1(p ChartPoint) CandleV1 {
+	return CandleV1{
+		Timestamp: p.Timestamp,
+		Open:      p.Open,
+		High:      p.High,
+		Low:       p.Low,
+		Close:     p.Close,
+		BBH:       number(p.BBH),
+		BBM:       number(p.BBM),
+		BBL:       number(p.BBL),
+		StochK:    number(p.StochK),
+		StochD:    number(p.StochD),
+		MFI:       number(p.MFI),
+		SMA:       number(p.SMA),
+		ADX:       number(p.ADX),
+	}
+}
+
+type NewsV1 struct {
+	ID        int       `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Author    string    `json:"author"`
+	Headline  string    `json:"headline"`
+	Summary   string    `json:"summary"`
+	URL       string    `json:"url"`
+	Symbols   []string  `json:"symbols"`
+}
+
+func newNewsV1(n News) NewsV1 {
+	return NewsV1{
+		ID:        n.ID,
+		CreatedAt: n.CreatedAt,
+		Author:    n.Author,
+		Headline:  n.Headline,
+		Summary:   n.Summary,
+		URL:       n.URL,
+		Symbols:   n.Symbols,
+	}
+}
+
+func writeErrorV1(c echo.Context, status int, message string) error {
+	return c.JSON(status, ErrorResponseV1{Error: ErrorV1{Status: status, Message: message}})
+}
+
+var apiV1 = apiFormat{
+	error: writeErrorV1,
+	ticker: func(row TickerTable) any {
+		return newTickerV1(row)
+	},
+	chart: func(symbol string, data *ChartData) any {
+		return newChartV1(symbol, data)
+	},
+}
+
+// isAPIV1 reports whether the request is for the versioned API, which always answers errors in JSON
+func isAPIV1(c echo.Context) bool {
+	path := c.Request().URL.Path
+	return path == API_V1 || strings.HasPrefix(path, API_V1+"/")
+}
+
+// httpErrorHandler writes errors of the versioned API, e.g. unknown routes, as error objects
+func httpErrorHandler(e *echo.Echo) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if !isAPIV1(c) || c.Response().Committed {
+			e.DefaultHTTPErrorHandler(err, c)
+			return
+		}
+		status := http.StatusInternalServerError
+		message := err.Error()
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			status = httpErr.Code
+			if m, ok := httpErr.Message.(string); ok {
+				message = m
+			} else {
+				message = http.StatusText(status)
+			}
+		}
+		writeErrorV1(c, status, message)
+	}
+}
+
+// registerAPIV1 adds the versioned API, described by the OpenAPI document at /api/v1/openapi.json
+func registerAPIV1(e *echo.Echo, ctx context.Context, storage *Storage, fetcher *Fetcher, live *Live, webhooks *Webhooks) {
+	g := e.Group(API_V1)
+	g.GET("/openapi.json", func(c echo.Context) error {
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, openapiV1)
+	})
+	g.GET("/tickers", func(c echo.Context) error {
+		rows := storage.GetRoomTickerTable(DEFAULT_ROOM)
+		tickers := make([]TickerV1, len(rows))
+		for i, row := range rows {
+			tickers[i] = newTickerV1(row)
+		}
+		return c.JSON(http.StatusOK, tickers)
+	})
+	g.GET("/tickers/:symbol", chartHandler(apiV1, storage))
+	g.GET("/tickers/:symbol/news", func(c echo.Context) error {
+		symbol := strings.ToUpper(c.Param("symbol"))
+		if !storage.HasTicker(symbol) {
+			return writeErrorV1(c, http.StatusNotFound, "Unknown symbol")
+		}
+		news := storage.GetNews(symbol)
+		ret := make([]NewsV1, len(news))
+		for i, n := range news {
+			ret[i] = newNewsV1(n)
+		}
+		return c.JSON(http.StatusOK, ret)
+	})
+	g.GET("/events", live.Handler)
+	registerWatchlistAPI(g, apiV1, ctx, storage, fetcher, live, webhooks)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// fallingStorage has a ticker closing at its low every day, so Stochastic %K is a real zero
+func fallingStorage(t *testing.T, days int) *Storage {
+	s := NewStorage()
+	if _, err := s.Watch(DEFAULT_ROOM, "AAPL", 0); err != nil {
+		t.Fatal(err)
+	}
+	candles := make([]Candle, days)
+	start := time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC)
+	for i := range candles {
+		price := 1000 - float64(i)
+		candles[i] = Candle{Timestamp: start.AddDate(0, 0, i), Open: price + 0.5, High: price + 1, Low: price, Close: price, Volume: 1000 + float64(i%7)}
+	}
+	s.InsertCandles("AAPL", candles...)
+	return s
+}
+
+func TestChartV1Nulls(t *testing.T) {
+	s := fallingStorage(t, 250)
+	chart := newChartV1("AAPL", s.GetChartData("AAPL"))
+	if len(chart.Timestamp) != 250 {
+		t.Fatalf("Got %d candles", len(chart.Timestamp))
+	}
+	tests := []struct {
+		name     string
+		values   []number
+		lookback int
+	}{
+		{"bbh", chart.BBH, 49},
+		{"stochK", chart.StochK, 17},
+		{"stochD", chart.StochD, 17},
+		{"mfi", chart.MFI, 14},
+		{"sma", chart.SMA, 199},
+		{"adx", chart.ADX, 27},
+	}
+	for _, tt := range tests {
+		for i, v := range tt.values {
+			if null := math.IsNaN(float64(v)); null != (i < tt.lookback) {
+				t.Errorf("%s[%d] = %v, want null only before %d", tt.name, i, v, tt.lookback)
+				break
+			}
+		}
+	}
+	if k := chart.StochK[len(chart.StochK)-1]; k != 0 {
+		t.Errorf("Last stochK = %v, want 0", k)
+	}
+
+	// Ranges are relative to their first candle
+	q := ChartQuery{From: time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC), Limit: 0, Fields: []string{"stochk", "sma"}}
+	chart = newChartV1("AAPL", s.GetChartRange("AAPL", q))
+	for i, v := range chart.StochK {
+		if null := math.IsNaN(float64(v)); null != (i < 7) {
+			t.Errorf("stochK[%d] = %v in range, want null only before 7", i, v)
+			break
+		}
+	}
+	if chart.BBH != nil {
+		t.Errorf("Got unselected bbh")
+	}
+	buf, err := json.Marshal(chart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := struct {
+		StochK []*float64 `json:"stochK"`
+	}{}
+	json.Unmarshal(buf, &v)
+	if v.StochK[0] != nil || v.StochK[len(v.StochK)-1] == nil || *v.StochK[len(v.StochK)-1] != 0 {
+		t.Errorf("Got stochK %s", buf)
+	}
+
+	// The legacy API keeps zeros
+	if _, err := json.Marshal(s.GetChartData("AAPL")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCandleV1Nulls(t *testing.T) {
+	s := fallingStorage(t, 100)
+	p, ok := s.GetChartPoint("AAPL")
+	if !ok {
+		t.Fatal("No chart point")
+	}
+	c := newCandleV1(p)
+	if !math.IsNaN(float64(c.SMA)) {
+		t.Errorf("SMA = %v, want null before 200 candles", c.SMA)
+	}
+	if c.StochK != 0 || math.IsNaN(float64(c.ADX)) || math.IsNaN(float64(c.BBL)) {
+		t.Errorf("Got %+v", c)
+	}
+
+	// Too few candles for any indicator
+	s = fallingStorage(t, 10)
+	p, _ = s.GetChartPoint("AAPL")
+	c = newCandleV1(p)
+	for name, v := range map[string]number{"bbh": c.BBH, "stochK": c.StochK, "mfi": c.MFI, "adx": c.ADX} {
+		if !math.IsNaN(float64(v)) {
+			t.Errorf("%s = %v, want null", name, v)
+		}
+	}
+}
+
+func TestTickersV1Room(t *testing.T) {
+	s := fallingStorage(t, 30)
+	if _, err := s.Watch("!other:example.org", "MSFT", 50); err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	registerAPIV1(e, context.Background(), s, nil, NewLive(), NewWebhooks(nil, "", ""))
+	request := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, API_V1+path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Only the configured room's tickers are listed, as only they can be changed
+	rec := request(http.MethodGet, "/tickers", "")
+	tickers := []TickerV1{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &tickers); err != nil {
+		t.Fatal(err)
+	}
+	if len(tickers) != 1 || tickers[0].Symbol != "AAPL" {
+		t.Errorf("Got tickers %s", rec.Body)
+	}
+	if rec := request(http.MethodPut, "/tickers/MSFT", `{"buyPrice": 60}`); rec.Code != http.StatusNotFound {
+		t.Errorf("Got %d for other room's ticker", rec.Code)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		muted  bool
+		buy    float64
+	}{
+		{name: "mute", body: `{"mutedUntil": "2099-01-01T00:00:00Z"}`, status: http.StatusOK, muted: true},
+		{name: "buy price keeps mute", body: `{"buyPrice": 900}`, status: http.StatusOK, muted: true, buy: 900},
+		{name: "unmute", body: `{"mutedUntil": null}`, status: http.StatusOK, buy: 900},
+		{name: "nothing", body: `{}`, status: http.StatusBadRequest},
+		{name: "invalid time", body: `{"mutedUntil": "tomorrow"}`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := request(http.MethodPut, "/tickers/AAPL", tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("Got %d %s, want %d", rec.Code, rec.Body, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			ticker := TickerV1{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &ticker); err != nil {
+				t.Fatal(err)
+			}
+			if (ticker.MutedUntil != nil) != tt.muted || s.IsMuted(DEFAULT_ROOM, "AAPL") != tt.muted {
+				t.Errorf("Got mutedUntil %v", ticker.MutedUntil)
+			}
+			if float64(ticker.BuyPrice) != tt.buy {
+				t.Errorf("Got buyPrice %v, want %v", ticker.BuyPrice, tt.buy)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/time/rate"
+)
+
+const (
+	SESSION_COOKIE = "robotrader_session"
+	SESSION_TTL    = 7 * 24 * time.Hour
+	LOGIN_RATE     = time.Second
+	LOGIN_BURST    = 5
+	LOGIN_IDLE     = 10 * time.Minute
+	// DUMMY_PASSWORD is hashed for comparing unknown users
+	DUMMY_PASSWORD = "robotrader"
+)
+
+// Auth protects the API with bearer tokens for programs and session cookies for the web UI
+type Auth struct {
+	tokens   map[string]string // name -> token
+	users    map[string][]byte // user -> bcrypt hash
+	secret   []byte
+	limiters *loginLimiters
+	// dummy is compared for unknown users, so they take as long as wrong passwords
+	dummy []byte
+}
+
+// NewAuth parses tokens as comma separated name=token pairs and users as user=bcrypt hash pairs,
+// see hash-password. Sessions are signed with the secret, a random one logs users out on restart.
+// Without tokens and users the API is open.
+func NewAuth(tokens string, users string, secret string) (*Auth, error) {
+	a := &Auth{
+		tokens:   map[string]string{},
+		users:    map[string][]byte{},
+		secret:   []byte(secret),
+		limiters: &loginLimiters{limiters: map[string]*loginLimiter{}},
+	}
+	for _, entry := range splitList(tokens) {
+		name, token, ok := strings.Cut(entry, "=")
+		if !ok || token == "" {
+			return nil, fmt.Errorf("Invalid API token: %s", name)
+		}
+		a.tokens[strings.TrimSpace(name)] = strings.TrimSpace(token)
+	}
+	for _, entry := range splitList(users) {
+		user, hash, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("Invalid web user: %s", entry)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("Invalid password hash of %s: %v", user, err)
+		}
+		a.users[strings.TrimSpace(user)] = []byte(strings.TrimSpace(hash))
+	}
+	if len(a.secret) == 0 {
+		a.secret = make([]byte, 32)
+		if _, err := rand.Read(a.secret); err != nil {
+			return nil, err
+		}
+	}
+	dummy, err := bcrypt.GenerateFromPassword([]byte(DUMMY_PASSWORD), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	a.dummy = dummy
+	return a, nil
+}
+
+func (a *Auth) Enabled() bool {
+	return len(a.tokens) > 0 || len(a.users) > 0
+}
+
+// Middleware requires a token or session on /api and /debug routes, the UI's static files, /health and
+// the OpenAPI document are public
+func (a *Auth) Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		path := c.Request().URL.Path
+		if !a.Enabled() || !(strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, "/debug/")) || path == API_V1+"/openapi.json" {
+			return next(c)
+		}
+		if token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer "); ok {
+			if name, ok := a.token(token); ok {
+				c.Set("user", name)
+				return next(c)
+			}
+		} else if cookie, err := c.Cookie(SESSION_COOKIE); err == nil {
+			if user, ok := a.verify(cookie.Value); ok {
+				c.Set("user", user)
+				return next(c)
+			}
+		}
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+		if isAPIV1(c) {
+			return writeErrorV1(c, http.StatusUnauthorized, "Unauthorized")
+		}
+		return c.String(http.StatusUnauthorized, "Unauthorized")
+	}
+}
+
+// Login checks the username and password, form or JSON, and sets the session cookie
+func (a *Auth) Login(c echo.Context) error {
+	req := struct {
+		Username string `form:"username" json:"username"`
+		Password string `form:"password" json:"password"`
+	}{}
+	if err := c.Bind(&req); err != nil {
+		return c.String(http.StatusBadRequest, "Invalid request body")
+	}
+	if !a.limiters.Allow(c.RealIP()) {
+		return c.String(http.StatusTooManyRequests, "Too many login attempts")
+	}
+	hash, ok := a.users[req.Username]
+	if !ok {
+		hash = a.dummy
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(req.Password)); err != nil || !ok {
+		return c.String(http.StatusUnauthorized, "Invalid username or password")
+	}
+	expires := time.Now().Add(SESSION_TTL)
+	c.SetCookie(&http.Cookie{
+		Name:     SESSION_COOKIE,
+		Value:    a.sign(req.Username, expires),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteStrictMode,
+	})
+	return c.JSON(http.StatusOK, map[string]string{"user": req.Username})
+}
+
+func (a *Auth) Logout(c echo.Context) error {
+	c.SetCookie(&http.Cookie{
+		Name:     SESSION_COOKIE,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return c.NoContent(http.StatusNoContent)
+}
+
+type loginLimiter struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+// loginLimiters rate limits logins per client IP, so one client guessing passwords doesn't lock out the others
+type loginLimiters struct {
+	mu       sync.Mutex
+	limiters map[string]*loginLimiter // IP -> limiter
+	swept    time.Time
+}
+
+// Allow takes a login attempt of the IP, limiters idle for LOGIN_IDLE are full again and evicted
+func (l *loginLimiters) Allow(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.swept) > LOGIN_IDLE {
+		for k, v := range l.limiters {
+			if now.Sub(v.seen) > LOGIN_IDLE {
+				delete(l.limiters, k)
+			}
+		}
+		l.swept = now
+	}
+	v, ok := l.limiters[ip]
+	if !ok {
+		v = &loginLimiter{limiter: rate.NewLimiter(rate.Every(LOGIN_RATE), LOGIN_BURST)}
+		l.limiters[ip] = v
+	}
+	v.seen = now
+	return v.limiter.AllowN(now, 1)
+}
+
+// token returns the name of the token, comparing in constant time
+func (a *Auth) token(token string) (string, bool) {
+	found := ""
+	for name, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			found = name
+		}
+	}
+	return found, found != ""
+}
+
+// sign returns a session of user|expiry|signature, users removed from the config are rejected in verify
+func (a *Auth) sign(user string, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(user)) + "|" + strconv.FormatInt(expires.Unix(), 10)
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(payload))
+	return payload + "|" + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (a *Auth) verify(session string) (string, bool) {
+	i := strings.LastIndex(session, "|")
+	if i < 0 {
+		return "", false
+	}
+	payload, signature := session[:i], session[i+1:]
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(payload))
+	if !hmac.Equal([]byte(signature), []byte(base64.RawURLEncoding.EncodeToString(mac.Sum(nil)))) {
+		return "", false
+	}
+	encoded, expiry, _ := strings.Cut(payload, "|")
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return "", false
+	}
+	user, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	if _, ok := a.users[string(user)]; !ok {
+		return "", false
+	}
+	return string(user), true
+}
+
+// runHashPassword prints the bcrypt hash of the password read from stdin, for WEB_USERS
+func runHashPassword(r io.Reader, w io.Writer) error {
+	password, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		return fmt.Errorf("Usage: echo <password> | robotrader hash-password")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(hash))
+	return err
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testAuth(t *testing.T) (*Auth, *echo.Echo) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewAuth("", "alice="+string(hash), "short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+	e.POST("/auth/login", a.Login)
+	return a, e
+}
+
+func login(e *echo.Echo, ip string, contentType string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, contentType)
+	req.RemoteAddr = ip + ":1234"
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthLogin(t *testing.T) {
+	a, e := testAuth(t)
+	form := url.Values{"username": {"alice"}, "password": {"hunter2"}}.Encode()
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"form", echo.MIMEApplicationForm, form, http.StatusOK},
+		{"json", echo.MIMEApplicationJSON, `{"username": "alice", "password": "hunter2"}`, http.StatusOK},
+		{"bad password", echo.MIMEApplicationJSON, `{"username": "alice", "password": "hunter3"}`, http.StatusUnauthorized},
+		{"unknown user", echo.MIMEApplicationJSON, `{"username": "bob", "password": "hunter2"}`, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := login(e, "192.0.2.1", tt.contentType, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("Got %d %s, want %d", rec.Code, rec.Body, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			cookies := rec.Result().Cookies()
+			if len(cookies) != 1 || cookies[0].Name != SESSION_COOKIE {
+				t.Fatalf("Got cookies %v", cookies)
+			}
+			if user, ok := a.verify(cookies[0].Value); !ok || user != "alice" {
+				t.Errorf("Session of %q, %v", user, ok)
+			}
+		})
+	}
+}
+
+func TestAuthLoginRateLimit(t *testing.T) {
+	_, e := testAuth(t)
+	for i := 0; i < LOGIN_BURST; i++ {
+		if rec := login(e, "192.0.2.1", echo.MIMEApplicationJSON, `{"username": "alice", "password": "guess"}`); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d got %d", i, rec.Code)
+		}
+	}
+	if rec := login(e, "192.0.2.1", echo.MIMEApplicationJSON, `{"username": "alice", "password": "hunter2"}`); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Got %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	// Other clients aren't locked out
+	if rec := login(e, "192.0.2.2", echo.MIMEApplicationJSON, `{"username": "alice", "password": "hunter2"}`); rec.Code != http.StatusOK {
+		t.Errorf("Other client got %d %s", rec.Code, rec.Body)
+	}
+}
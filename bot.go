@@ -2,18 +2,69 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"html"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/crypto/attachment"
 	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/id"
 )
 
+const (
+	REACTION_BUY       = "✅"
+	REACTION_MUTE      = "🔕"
+	REACTION_CHART     = "📈"
+	SIGNAL_EVENTS_KEEP = 1000
+)
+
 type Bot struct {
 	startTime time.Time
 	roomId    id.RoomID
 	client    *mautrix.Client
-	msg       chan string
+	msg       chan Message
+	signals   *signalEvents
+	outbox    *Outbox
+	threadId  id.EventID
+	// inviters reports whether invites of a sender are accepted besides members of the configured room
+	inviters func(sender string) bool
+}
+
+type signalEvent struct {
+	Signal Signal
+	Symbol string
+	Price  float64
+}
+
+// signalEvents maps the latest signal messages to their symbol for reaction shortcuts
+type signalEvents struct {
+	mu     sync.Mutex
+	events map[id.EventID]signalEvent
+	order  []id.EventID
+}
+
+func (s *signalEvents) add(eventId id.EventID, signal signalEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events[eventId] = signal
+	s.order = append(s.order, eventId)
+	if len(s.order) > SIGNAL_EVENTS_KEEP {
+		delete(s.events, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+func (s *signalEvents) get(eventId id.EventID) (signalEvent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	signal, ok := s.events[eventId]
+	return signal, ok
 }
 
 func (b *Bot) Write(p []byte) (n int, err error) {
@@ -21,7 +72,8 @@ func (b *Bot) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
-func NewBot(homeserver string, userId string, accessToken string, roomId string) *Bot {
+// NewBot creates a Matrix bot, outbox is the file of pending outbound events
+func NewBot(homeserver string, userId string, accessToken string, roomId string, outbox string, inviters func(sender string) bool) *Bot {
 	client, err := mautrix.NewClient(homeserver, id.UserID(userId), accessToken)
 	if err != nil {
 		return nil
@@ -30,9 +82,19 @@ func NewBot(homeserver string, userId string, accessToken string, roomId string)
 		startTime: time.Now(),
 		roomId:    id.RoomID(roomId),
 		client:    client,
-		msg:       make(chan string, 100),
+		msg:       make(chan Message, 100),
+		signals:   &signalEvents{events: map[id.EventID]signalEvent{}},
+		inviters:  inviters,
+	}
+	b.outbox, err = NewOutbox(client, outbox)
+	if err != nil {
+		return nil
 	}
-	client.Syncer.(*mautrix.DefaultSyncer).OnEvent(b.handler)
+	b.outbox.sent = b.sent
+	syncer := client.Syncer.(*mautrix.DefaultSyncer)
+	syncer.OnEventType(event.EventMessage, b.handler)
+	syncer.OnEventType(event.StateMember, b.invite)
+	syncer.OnEventType(event.EventReaction, b.reaction)
 	return b
 }
 
@@ -43,53 +105,281 @@ func (b *Bot) handler(ctx context.Context, evt *event.Event) {
 	if evt.Sender == b.client.UserID {
 		return
 	}
-	if evt.RoomID != b.roomId {
-		return
+	content := evt.Content.AsMessage()
+	// Reply in the thread of the command, or start one
+	thread := evt.ID
+	if content.RelatesTo != nil && content.RelatesTo.Type == event.RelThread {
+		thread = content.RelatesTo.EventID
 	}
-	b.msg <- evt.Content.AsMessage().Body
+	b.msg <- Message{Sender: evt.Sender.String(), Room: b.room(evt.RoomID), Thread: thread.String(), Body: content.Body}
 	b.client.SendReceipt(ctx, evt.RoomID, evt.ID, event.ReceiptTypeRead, mautrix.ReqSetReadMarkers{FullyRead: evt.ID})
 }
 
+// reaction turns reactions to signal messages into commands, so they are subject to permissions
+func (b *Bot) reaction(ctx context.Context, evt *event.Event) {
+	if evt.Timestamp < b.startTime.UnixMilli() {
+		return
+	}
+	if evt.Sender == b.client.UserID {
+		return
+	}
+	rel := evt.Content.AsReaction().GetRelatesTo()
+	signal, ok := b.signals.get(rel.GetAnnotationID())
+	if !ok {
+		return
+	}
+	var body string
+	switch strings.TrimSuffix(rel.GetAnnotationKey(), "\ufe0f") {
+	case REACTION_BUY:
+		if signal.Signal != SignalBuy {
+			return
+		}
+		body = fmt.Sprintf("add %s %s", signal.Symbol, strconv.FormatFloat(signal.Price, 'f', -1, 64))
+	case REACTION_MUTE:
+		body = "mute " + signal.Symbol
+	case REACTION_CHART:
+		body = fmt.Sprintf("chart %s", signal.Symbol)
+	default:
+		return
+	}
+	b.msg <- Message{Sender: evt.Sender.String(), Room: b.room(evt.RoomID), Thread: rel.GetAnnotationID().String(), Body: body}
+}
+
+func (b *Bot) room(roomId id.RoomID) string {
+	if roomId == b.roomId {
+		return DEFAULT_ROOM
+	}
+	return roomId.String()
+}
+
+// invite joins rooms and direct chats the bot is invited to by trusted users, each gets its own watchlist
+func (b *Bot) invite(ctx context.Context, evt *event.Event) {
+	if evt.GetStateKey() != b.client.UserID.String() || evt.Content.AsMember().Membership != event.MembershipInvite {
+		return
+	}
+	if !b.trusted(ctx, evt.Sender) {
+		log.Printf("Ignored invite to %s from %s", evt.RoomID, evt.Sender)
+		return
+	}
+	if _, err := b.client.JoinRoomByID(ctx, evt.RoomID); err != nil {
+		log.Printf("Failed to join %s: %v", evt.RoomID, err)
+	}
+}
+
+// trusted reports whether the user is in ROLES or a member of the configured room
+func (b *Bot) trusted(ctx context.Context, userId id.UserID) bool {
+	if b.inviters != nil && b.inviters(userId.String()) {
+		return true
+	}
+	members, err := b.client.JoinedMembers(ctx, b.roomId)
+	if err != nil {
+		log.Printf("Failed to get members of %s: %v", b.roomId, err)
+		return false
+	}
+	_, ok := members.Joined[userId]
+	return ok
+}
+
+// Room returns a bot sending to another Matrix room sharing the client
+func (b *Bot) Room(room string) (Notifier, bool) {
+	if !strings.HasPrefix(room, "!") {
+		return nil, false
+	}
+	r := *b
+	r.roomId = id.RoomID(room)
+	return &r, true
+}
+
+// Thread returns a bot replying in the thread of a Matrix event, or in the room without one
+func (b *Bot) Thread(thread string) Notifier {
+	if thread != "" && !strings.HasPrefix(thread, "$") {
+		return b
+	}
+	r := *b
+	r.threadId = id.EventID(thread)
+	return &r
+}
+
+// send queues the message in the outbox
+func (b *Bot) send(content *event.MessageEventContent) (<-chan outboxResult, error) {
+	if b.threadId != "" {
+		content.RelatesTo = (&event.RelatesTo{}).SetThread(b.threadId, b.threadId)
+	}
+	return b.outbox.Enqueue(b.roomId, event.EventMessage, content, nil)
+}
+
+// sent offers the reaction shortcuts on delivered signals
+func (b *Bot) sent(item *outboxItem, eventId id.EventID) {
+	if item.Signal == nil {
+		return
+	}
+	b.signals.add(eventId, *item.Signal)
+	keys := []string{REACTION_MUTE, REACTION_CHART}
+	// Adding at the signal's price only makes sense when buying
+	if item.Signal.Signal == SignalBuy {
+		keys = append([]string{REACTION_BUY}, keys...)
+	}
+	for _, key := range keys {
+		content := event.ReactionEventContent{}
+		content.RelatesTo.SetAnnotation(eventId, key)
+		b.outbox.Enqueue(item.RoomID, event.EventReaction, &content, nil)
+	}
+}
+
 func (b *Bot) Run(ctx context.Context) error {
+	go b.outbox.Run(ctx)
 	return b.client.SyncWithContext(ctx)
 }
 
-func (b *Bot) Message() chan string {
+func (b *Bot) Message() <-chan Message {
 	return b.msg
 }
 
-func (b *Bot) SendText(msg string) {
-	b.client.SendText(context.Background(), b.roomId, msg)
+func (b *Bot) SendText(msg string) error {
+	_, err := b.send(&event.MessageEventContent{
+		MsgType: event.MsgText,
+		Body:    msg,
+	})
+	return err
+}
+
+// SendSignal sends the alert, the reaction shortcuts are offered once it is delivered
+func (b *Bot) SendSignal(signal Signal, symbol string, price float64, msg string) error {
+	content := &event.MessageEventContent{
+		MsgType: event.MsgText,
+		Body:    msg,
+	}
+	if b.threadId != "" {
+		content.RelatesTo = (&event.RelatesTo{}).SetThread(b.threadId, b.threadId)
+	}
+	_, err := b.outbox.Enqueue(b.roomId, event.EventMessage, content, &signalEvent{Signal: signal, Symbol: symbol, Price: price})
+	return err
 }
 
-func (b *Bot) SendHtml(msg string) {
-	b.client.SendMessageEvent(context.Background(), b.roomId, event.EventMessage, event.MessageEventContent{
+// SendHtml sends formatted text, text is the fallback for clients without HTML
+func (b *Bot) SendHtml(text string, html string) error {
+	_, err := b.send(&event.MessageEventContent{
 		MsgType:       event.MsgText,
-		Body:          "",
+		Body:          text,
 		Format:        "org.matrix.custom.html",
-		FormattedBody: msg,
+		FormattedBody: html,
 	})
+	return err
+}
+
+func (b *Bot) SendCode(msg string) error {
+	_, err := b.send(codeContent(msg))
+	return err
 }
 
-func (b *Bot) SendCode(msg string) {
-	b.client.SendMessageEvent(context.Background(), b.roomId, event.EventMessage, event.MessageEventContent{
+func codeContent(msg string) *event.MessageEventContent {
+	return &event.MessageEventContent{
 		MsgType:       event.MsgText,
 		Body:          msg,
 		Format:        "org.matrix.custom.html",
-		FormattedBody: "<pre><code class=\"language-plaintext\">" + msg + "</code></pre>",
-	})
+		FormattedBody: "<pre><code class=\"language-plaintext\">" + html.EscapeString(msg) + "</code></pre>",
+	}
+}
+
+func tableContent(table Table) *event.MessageEventContent {
+	return &event.MessageEventContent{
+		MsgType:       event.MsgText,
+		Body:          renderTable(table),
+		Format:        "org.matrix.custom.html",
+		FormattedBody: renderHtmlTable(table),
+	}
+}
+
+func (b *Bot) SendTable(table Table) error {
+	_, err := b.send(tableContent(table))
+	return err
 }
 
 func (b *Bot) SendImage(buf []byte, contentType string, filename string) error {
-	resp, err := b.client.UploadBytes(context.Background(), buf, contentType)
+	content, err := b.upload(event.MsgImage, buf, contentType, filename)
+	if err != nil {
+		return err
+	}
+	_, err = b.send(content)
+	return err
+}
+
+func (b *Bot) SendFile(buf []byte, contentType string, filename string) error {
+	content, err := b.upload(event.MsgFile, buf, contentType, filename)
 	if err != nil {
 		return err
 	}
-	_, err = b.client.SendMessageEvent(context.Background(), b.roomId, event.EventMessage, event.MessageEventContent{
-		MsgType:  event.MsgImage,
+	_, err = b.send(content)
+	return err
+}
+
+// upload stores the file on the homeserver, encrypted in encrypted rooms, and returns the message referring to it
+func (b *Bot) upload(msgType event.MessageType, buf []byte, contentType string, filename string) (*event.MessageEventContent, error) {
+	ctx := context.Background()
+	content := &event.MessageEventContent{
+		MsgType:  msgType,
 		Body:     filename,
-		URL:      id.ContentURIString(resp.ContentURI.String()),
 		FileName: filename,
-	})
-	return err
+		Info: &event.FileInfo{
+			MimeType: contentType,
+			Size:     len(buf),
+		},
+	}
+	var file *attachment.EncryptedFile
+	if b.client.Crypto != nil {
+		encrypted, err := b.client.StateStore.IsEncrypted(ctx, b.roomId)
+		if err != nil {
+			return nil, err
+		}
+		if encrypted {
+			file = attachment.NewEncryptedFile()
+			// Other backends send the same buffer
+			buf = slices.Clone(buf)
+			file.EncryptInPlace(buf)
+			contentType = "application/octet-stream"
+		}
+	}
+	resp, err := b.client.UploadBytes(ctx, buf, contentType)
+	if err != nil {
+		return nil, err
+	}
+	if file != nil {
+		content.File = &event.EncryptedFileInfo{EncryptedFile: *file, URL: id.ContentURIString(resp.ContentURI.String())}
+	} else {
+		content.URL = id.ContentURIString(resp.ContentURI.String())
+	}
+	return content, nil
+}
+
+// SendDashboard edits the dashboard message in place, or posts and pins a new one
+func (b *Bot) SendDashboard(dashboardId string, table Table) (string, error) {
+	ctx := context.Background()
+	content := tableContent(table)
+	if dashboardId != "" {
+		content.SetEdit(id.EventID(dashboardId))
+		_, err := b.outbox.Enqueue(b.roomId, event.EventMessage, content, nil)
+		return dashboardId, err
+	}
+	// Wait for the event ID of the new dashboard
+	sent, err := b.outbox.Enqueue(b.roomId, event.EventMessage, content, nil)
+	if err != nil {
+		return "", err
+	}
+	var resp outboxResult
+	select {
+	case resp = <-sent:
+	case <-time.After(OUTBOX_TIMEOUT):
+		return "", fmt.Errorf("Dashboard is not sent yet")
+	}
+	if resp.err != nil {
+		return "", resp.err
+	}
+	pinned := event.PinnedEventsEventContent{}
+	// No pinned events yet is not an error
+	b.client.StateEvent(ctx, b.roomId, event.StatePinnedEvents, "", &pinned)
+	pinned.Pinned = append(pinned.Pinned, resp.eventId)
+	if _, err := b.client.SendStateEvent(ctx, b.roomId, event.StatePinnedEvents, "", &pinned); err != nil {
+		return resp.eventId.String(), fmt.Errorf("Failed to pin dashboard: %v", err)
+	}
+	return resp.eventId.String(), nil
 }
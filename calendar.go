@@ -0,0 +1,51 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+)
+
+// Calendar tells trading days from the Alpaca market calendar, fetched once per year
+type Calendar struct {
+	client *alpaca.Client
+	mu     sync.Mutex
+	years  map[int]map[string]bool // year -> trading dates
+}
+
+// NewCalendar uses the trading API at baseURL, https://api.alpaca.markets by default, paper
+// trading keys need https://paper-api.alpaca.markets
+func NewCalendar(apiKey string, secretKey string, baseURL string) *Calendar {
+	return &Calendar{
+		client: alpaca.NewClient(alpaca.ClientOpts{
+			APIKey:    apiKey,
+			APISecret: secretKey,
+			BaseURL:   baseURL,
+		}),
+		years: map[int]map[string]bool{},
+	}
+}
+
+// IsTradingDay reports whether the market is open on the day in New York, holidays included
+func (c *Calendar) IsTradingDay(t time.Time) (bool, error) {
+	t = t.In(marketLocation)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	days, ok := c.years[t.Year()]
+	if !ok {
+		calendar, err := c.client.GetCalendar(alpaca.GetCalendarRequest{
+			Start: time.Date(t.Year(), 1, 1, 0, 0, 0, 0, marketLocation),
+			End:   time.Date(t.Year(), 12, 31, 0, 0, 0, 0, marketLocation),
+		})
+		if err != nil {
+			return false, err
+		}
+		days = map[string]bool{}
+		for _, day := range calendar {
+			days[day.Date] = true
+		}
+		c.years[t.Year()] = days
+	}
+	return days[t.Format(time.DateOnly)], nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	CHART_WIDTH  = 1200
+	CHART_HEIGHT = 900
+	CHART_DAYS   = 120
+	CHART_MARGIN = 60
+)
+
+var (
+	chartBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	chartGrid       = color.RGBA{0xdd, 0xdd, 0xdd, 0xff}
+	chartText       = color.RGBA{0x33, 0x33, 0x33, 0xff}
+	chartUp         = color.RGBA{0x47, 0xb2, 0x62, 0xff}
+	chartDown       = color.RGBA{0xeb, 0x54, 0x54, 0xff}
+	chartRed        = color.RGBA{0xff, 0x00, 0x00, 0xff}
+	chartBlue       = color.RGBA{0x00, 0x00, 0xff, 0xff}
+	chartGreen      = color.RGBA{0x00, 0x80, 0x00, 0xff}
+	chartOrange     = color.RGBA{0xff, 0xa5, 0x00, 0xff}
+	chartPurple     = color.RGBA{0x80, 0x00, 0x80, 0xff}
+)
+
+type chartPanel struct {
+	img      *image.RGBA
+	rect     image.Rectangle
+	min, max float64
+	n        int
+}
+
+func (p *chartPanel) x(i int) int {
+	return p.rect.Min.X + (2*i+1)*p.rect.Dx()/(2*p.n)
+}
+
+func (p *chartPanel) y(v float64) int {
+	return p.rect.Max.Y - int((v-p.min)/(p.max-p.min)*float64(p.rect.Dy()))
+}
+
+// series draws a line, skipping undefined (zero) values
+func (p *chartPanel) series(values []float64, c color.Color) {
+	for i := 1; i < len(values) && i < p.n; i++ {
+		if values[i-1] == 0 || values[i] == 0 || math.IsNaN(values[i-1]) || math.IsNaN(values[i]) {
+			continue
+		}
+		drawLine(p.img, p.x(i-1), p.y(values[i-1]), p.x(i), p.y(values[i]), c)
+	}
+}
+
+func (p *chartPanel) level(v float64, c color.Color) {
+	drawLine(p.img, p.rect.Min.X, p.y(v), p.rect.Max.X, p.y(v), c)
+}
+
+func (p *chartPanel) frame(title string) {
+	drawRect(p.img, p.rect, chartGrid)
+	drawText(p.img, p.rect.Min.X+4, p.rect.Min.Y+14, title, chartText)
+	drawText(p.img, p.rect.Max.X+4, p.rect.Min.Y+10, fmt.Sprintf("%.2f", p.max), chartText)
+	drawText(p.img, p.rect.Max.X+4, p.rect.Max.Y, fmt.Sprintf("%.2f", p.min), chartText)
+}
+
+// RenderChart draws a candlestick chart with Bollinger bands and SMA above Stoch, MFI and ADX panels as PNG
+func RenderChart(symbol string, data *ChartData, days int) ([]byte, error) {
+	if data == nil || len(data.Close) == 0 {
+		return nil, fmt.Errorf("No data for %s", symbol)
+	}
+	start := max(len(data.Close)-days, 0)
+	tail := func(values []float64) []float64 {
+		if len(values) != len(data.Close) {
+			return nil
+		}
+		return values[start:]
+	}
+	open, high, low, close := tail(data.Open), tail(data.High), tail(data.Low), tail(data.Close)
+	bbh, bbm, bbl, sma := tail(data.BBH), tail(data.BBM), tail(data.BBL), tail(data.SMA)
+	n := len(close)
+
+	img := image.NewRGBA(image.Rect(0, 0, CHART_WIDTH, CHART_HEIGHT))
+	draw.Draw(img, img.Bounds(), &image.Uniform{chartBackground}, image.Point{}, draw.Src)
+
+	left, right := 10, CHART_WIDTH-CHART_MARGIN
+	priceBottom := CHART_HEIGHT * 55 / 100
+	panelHeight := (CHART_HEIGHT - priceBottom - 40) / 3
+
+	price := &chartPanel{img: img, rect: image.Rect(left, 30, right, priceBottom), n: n, min: math.Inf(1), max: math.Inf(-1)}
+	for _, values := range [][]float64{high, low, bbh, bbl, sma} {
+		for _, v := range values {
+			if v > 0 {
+				price.min = math.Min(price.min, v)
+				price.max = math.Max(price.max, v)
+			}
+		}
+	}
+	if price.max <= price.min {
+		price.max = price.min + 1
+	}
+	price.frame(fmt.Sprintf("%s %dd  close $%.2f", symbol, n, close[n-1]))
+	price.series(bbh, chartRed)
+	price.series(bbm, chartBlue)
+	price.series(bbl, chartGreen)
+	price.series(sma, chartPurple)
+	if data.BuyPrice > price.min && data.BuyPrice < price.max {
+		price.level(data.BuyPrice, chartOrange)
+	}
+	bodyWidth := max(price.rect.Dx()/n*6/10, 1)
+	for i := 0; i < n; i++ {
+		c := chartUp
+		if close[i] < open[i] {
+			c = chartDown
+		}
+		x := price.x(i)
+		drawLine(img, x, price.y(high[i]), x, price.y(low[i]), c)
+		top, bottom := price.y(math.Max(open[i], close[i])), price.y(math.Min(open[i], close[i]))
+		draw.Draw(img, image.Rect(x-bodyWidth/2, top, x-bodyWidth/2+bodyWidth, bottom+1), &image.Uniform{c}, image.Point{}, draw.Src)
+	}
+
+	panels := []struct {
+		title  string
+		series [][]float64
+		colors []color.Color
+		levels []float64
+	}{
+		{"Stoch", [][]float64{tail(data.StochK), tail(data.StochD)}, []color.Color{chartBlue, chartOrange}, []float64{20, 80}},
+		{"MFI", [][]float64{tail(data.MFI)}, []color.Color{chartBlue}, []float64{30, 70}},
+		{"ADX", [][]float64{tail(data.ADX)}, []color.Color{chartBlue}, []float64{25}},
+	}
+	for k, v := range panels {
+		top := priceBottom + 20 + k*panelHeight
+		p := &chartPanel{img: img, rect: image.Rect(left, top+10, right, top+panelHeight), n: n, min: 0, max: 100}
+		p.frame(v.title)
+		for _, level := range v.levels {
+			p.level(level, chartGrid)
+		}
+		for i, values := range v.series {
+			p.series(values, v.colors[i])
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func drawRect(img *image.RGBA, r image.Rectangle, c color.Color) {
+	drawLine(img, r.Min.X, r.Min.Y, r.Max.X, r.Min.Y, c)
+	drawLine(img, r.Min.X, r.Max.Y, r.Max.X, r.Max.Y, c)
+	drawLine(img, r.Min.X, r.Min.Y, r.Min.X, r.Max.Y, c)
+	drawLine(img, r.Max.X, r.Min.Y, r.Max.X, r.Max.Y, c)
+}
+
+func drawText(img *image.RGBA, x, y int, text string, c color.Color) {
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(c),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
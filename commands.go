@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ArgType int
+
+const (
+	ArgString ArgType = iota
+	ArgSymbol
+	ArgFloat
+	ArgInt
+	ArgDuration
+	ArgTarget // A symbol or all, which parses to ALL_SYMBOLS
+)
+
+const ALL_SYMBOLS = "*"
+
+var symbolPattern = regexp.MustCompile(`^[A-Z][A-Z0-9.]{0,9}$`)
+
+type Arg struct {
+	Name     string
+	Type     ArgType
+	Optional bool
+	Choices  []string
+}
+
+func (a Arg) parse(value string) (any, error) {
+	switch a.Type {
+	case ArgTarget:
+		if strings.ToLower(value) == "all" {
+			return ALL_SYMBOLS, nil
+		}
+		return Arg{Name: a.Name, Type: ArgSymbol}.parse(value)
+	case ArgSymbol:
+		symbol := strings.ToUpper(value)
+		if !symbolPattern.MatchString(symbol) {
+			return nil, fmt.Errorf("invalid symbol %q", value)
+		}
+		return symbol, nil
+	case ArgFloat:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("invalid %s %q", a.Name, value)
+		}
+		return v, nil
+	case ArgInt:
+		v, err := strconv.Atoi(value)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("invalid %s %q", a.Name, value)
+		}
+		return v, nil
+	case ArgDuration:
+		v, err := parseDuration(value)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("invalid %s %q", a.Name, value)
+		}
+		return v, nil
+	default:
+		if len(a.Choices) > 0 && !slices.Contains(a.Choices, strings.ToLower(value)) {
+			return nil, fmt.Errorf("invalid %s %q, expected one of %s", a.Name, value, strings.Join(a.Choices, ", "))
+		}
+		if len(a.Choices) > 0 {
+			return strings.ToLower(value), nil
+		}
+		return value, nil
+	}
+}
+
+func (a Arg) usage() string {
+	name := a.Name
+	if len(a.Choices) > 0 {
+		name = strings.Join(a.Choices, "|")
+	}
+	if a.Optional {
+		return "[" + name + "]"
+	}
+	return "<" + name + ">"
+}
+
+// Args holds parsed command arguments by name
+type Args map[string]any
+
+func (a Args) Has(name string) bool {
+	_, ok := a[name]
+	return ok
+}
+
+func (a Args) String(name string) string {
+	v, _ := a[name].(string)
+	return v
+}
+
+func (a Args) Float(name string) float64 {
+	v, _ := a[name].(float64)
+	return v
+}
+
+func (a Args) Int(name string) int {
+	v, _ := a[name].(int)
+	return v
+}
+
+func (a Args) Duration(name string) time.Duration {
+	v, _ := a[name].(time.Duration)
+	return v
+}
+
+// Request is the message a command runs for and the notifier replying to its room
+type Request struct {
+	Message
+	Reply Notifier
+}
+
+type Command struct {
+	Name    string
+	Aliases []string
+	Args    []Arg
+	Help    string
+	Role    Role
+	Run     func(req *Request, args Args) error
+}
+
+func (c *Command) Usage() string {
+	s := []string{c.Name}
+	for _, a := range c.Args {
+		s = append(s, a.usage())
+	}
+	return strings.Join(s, " ")
+}
+
+// Parse converts positional arguments according to the command's schema
+func (c *Command) Parse(values []string) (Args, error) {
+	args := Args{}
+	if len(values) > len(c.Args) {
+		return nil, fmt.Errorf("too many arguments")
+	}
+	for k, a := range c.Args {
+		if k >= len(values) {
+			if !a.Optional {
+				return nil, fmt.Errorf("missing %s", a.Name)
+			}
+			continue
+		}
+		v, err := a.parse(values[k])
+		if err != nil {
+			return nil, err
+		}
+		args[a.Name] = v
+	}
+	return args, nil
+}
+
+type UsageError struct {
+	Command *Command
+	Err     error
+}
+
+func (e *UsageError) Error() string {
+	return fmt.Sprintf("%s: %v\nUsage: %s", e.Command.Name, e.Err, e.Command.Usage())
+}
+
+// Commands is the registry of chat commands
+type Commands struct {
+	commands map[string]*Command
+	aliases  map[string]string
+	// Authorize is called before running a command, if set
+	Authorize func(msg Message, cmd *Command) error
+}
+
+func NewCommands() *Commands {
+	return &Commands{
+		commands: map[string]*Command{},
+		aliases:  map[string]string{},
+	}
+}
+
+func (c *Commands) Register(cmd *Command) {
+	c.commands[cmd.Name] = cmd
+	for _, alias := range cmd.Aliases {
+		c.aliases[alias] = cmd.Name
+	}
+}
+
+func (c *Commands) Lookup(name string) (*Command, bool) {
+	name = strings.ToLower(name)
+	if v, ok := c.aliases[name]; ok {
+		name = v
+	}
+	cmd, ok := c.commands[name]
+	return cmd, ok
+}
+
+// Parse splits a message into a command and its typed arguments
+func (c *Commands) Parse(msg string) (*Command, Args, error) {
+	fields := strings.Fields(msg)
+	if len(fields) == 0 {
+		return nil, nil, fmt.Errorf("Empty command")
+	}
+	cmd, ok := c.Lookup(fields[0])
+	if !ok {
+		return nil, nil, fmt.Errorf("Unknown command %q, try help", fields[0])
+	}
+	args, err := cmd.Parse(fields[1:])
+	if err != nil {
+		return cmd, nil, &UsageError{Command: cmd, Err: err}
+	}
+	return cmd, args, nil
+}
+
+// Dispatch parses and runs a message, returning usage, permission or command errors for the user
+func (c *Commands) Dispatch(msg Message, reply Notifier) error {
+	if strings.TrimSpace(msg.Body) == "" {
+		return nil
+	}
+	cmd, args, err := c.Parse(msg.Body)
+	if err != nil {
+		return err
+	}
+	if c.Authorize != nil {
+		if err := c.Authorize(msg, cmd); err != nil {
+			return err
+		}
+	}
+	return cmd.Run(&Request{Message: msg, Reply: reply}, args)
+}
+
+func (c *Commands) Help(name string) string {
+	if name != "" {
+		cmd, ok := c.Lookup(name)
+		if !ok {
+			return fmt.Sprintf("Unknown command %q", name)
+		}
+		s := fmt.Sprintf("Usage: %s\n%s", cmd.Usage(), cmd.Help)
+		if cmd.Role > RoleViewer {
+			s += "\nRequires: " + cmd.Role.String()
+		}
+		if len(cmd.Aliases) > 0 {
+			s += "\nAliases: " + strings.Join(cmd.Aliases, ", ")
+		}
+		return s
+	}
+	names := make([]string, 0, len(c.commands))
+	for k := range c.commands {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	lines := []string{"Commands:"}
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("%s - %s", c.commands[name].Usage(), c.commands[name].Help))
+	}
+	lines = append(lines, "Use help <command> for details")
+	return strings.Join(lines, "\n")
+}
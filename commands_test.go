@@ -0,0 +1,143 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testCommands() *Commands {
+	c := NewCommands()
+	c.Register(&Command{
+		Name:    "add",
+		Aliases: []string{"buy"},
+		Args:    []Arg{{Name: "symbol", Type: ArgSymbol}, {Name: "buy price", Type: ArgFloat, Optional: true}},
+		Help:    "Add ticker",
+		Role:    RoleTrader,
+	})
+	c.Register(&Command{
+		Name: "chart",
+		Args: []Arg{{Name: "symbol", Type: ArgSymbol}, {Name: "range", Choices: []string{"1m", "1y"}, Optional: true}},
+		Help: "Send chart",
+	})
+	c.Register(&Command{
+		Name:    "mute",
+		Aliases: []string{"snooze"},
+		Args:    []Arg{{Name: "symbol|all", Type: ArgTarget}, {Name: "duration", Type: ArgDuration, Optional: true}},
+		Help:    "Mute alerts",
+	})
+	return c
+}
+
+func TestCommandsParse(t *testing.T) {
+	tests := []struct {
+		msg  string
+		cmd  string
+		args Args
+		err  string
+	}{
+		{msg: "add aapl", cmd: "add", args: Args{"symbol": "AAPL"}},
+		{msg: "add AAPL 123.5", cmd: "add", args: Args{"symbol": "AAPL", "buy price": 123.5}},
+		{msg: "BUY brk.b 1", cmd: "add", args: Args{"symbol": "BRK.B", "buy price": 1.0}},
+		{msg: "snooze all 2d", cmd: "mute", args: Args{"symbol|all": ALL_SYMBOLS, "duration": 48 * time.Hour}},
+		{msg: "mute msft 90m", cmd: "mute", args: Args{"symbol|all": "MSFT", "duration": 90 * time.Minute}},
+		{msg: "chart AAPL 1Y", cmd: "chart", args: Args{"symbol": "AAPL", "range": "1y"}},
+		{msg: "chart AAPL 5y", cmd: "chart", err: `invalid range "5y", expected one of 1m, 1y`},
+		{msg: "add", cmd: "add", err: "missing symbol"},
+		{msg: "add AAPL 1 2", cmd: "add", err: "too many arguments"},
+		{msg: "add AAPL abc", cmd: "add", err: `invalid buy price "abc"`},
+		{msg: "add AAPL -1", cmd: "add", err: `invalid buy price "-1"`},
+		{msg: "add AAPL NaN", cmd: "add", err: `invalid buy price "NaN"`},
+		{msg: "add AAPL inf", cmd: "add", err: `invalid buy price "inf"`},
+		{msg: "add 1AAPL", cmd: "add", err: `invalid symbol "1AAPL"`},
+		{msg: "mute AAPL 0d", cmd: "mute", err: `invalid duration "0d"`},
+		{msg: "sell AAPL", err: `Unknown command "sell", try help`},
+		{msg: "  ", err: "Empty command"},
+	}
+	c := testCommands()
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			cmd, args, err := c.Parse(tt.msg)
+			if tt.cmd == "" && cmd != nil || tt.cmd != "" && (cmd == nil || cmd.Name != tt.cmd) {
+				t.Fatalf("got command %v, want %q", cmd, tt.cmd)
+			}
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("got %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestArgParse(t *testing.T) {
+	tests := []struct {
+		arg   Arg
+		value string
+		want  any
+		ok    bool
+	}{
+		{Arg{Type: ArgString}, "Hello", "Hello", true},
+		{Arg{Choices: []string{"csv", "json"}}, "JSON", "json", true},
+		{Arg{Choices: []string{"csv", "json"}}, "xml", nil, false},
+		{Arg{Type: ArgSymbol}, "aapl", "AAPL", true},
+		{Arg{Type: ArgSymbol}, "TOOLONGSYMBOL", nil, false},
+		{Arg{Type: ArgTarget}, "ALL", ALL_SYMBOLS, true},
+		{Arg{Type: ArgTarget}, "spy", "SPY", true},
+		{Arg{Type: ArgFloat}, "0", 0.0, true},
+		{Arg{Type: ArgFloat}, "1e3", 1000.0, true},
+		{Arg{Type: ArgFloat}, "-0.5", nil, false},
+		{Arg{Type: ArgFloat}, "nan", nil, false},
+		{Arg{Type: ArgFloat}, "+Inf", nil, false},
+		{Arg{Type: ArgInt}, "10", 10, true},
+		{Arg{Type: ArgInt}, "0", nil, false},
+		{Arg{Type: ArgInt}, "1.5", nil, false},
+		{Arg{Type: ArgDuration}, "1h30m", 90 * time.Minute, true},
+		{Arg{Type: ArgDuration}, "3d", 72 * time.Hour, true},
+		{Arg{Type: ArgDuration}, "-1h", nil, false},
+		{Arg{Type: ArgDuration}, "soon", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := tt.arg.parse(tt.value)
+		if (err == nil) != tt.ok {
+			t.Errorf("parse(%q) of type %d: got error %v, want ok %v", tt.value, tt.arg.Type, err, tt.ok)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parse(%q) of type %d: got %v, want %v", tt.value, tt.arg.Type, got, tt.want)
+		}
+	}
+}
+
+func TestCommandsHelp(t *testing.T) {
+	c := testCommands()
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"", []string{
+			"Commands:",
+			"add <symbol> [buy price] - Add ticker",
+			"chart <symbol> [1m|1y] - Send chart",
+			"mute <symbol|all> [duration] - Mute alerts",
+			"Use help <command> for details",
+		}},
+		{"buy", []string{"Usage: add <symbol> [buy price]", "Add ticker", "Requires: trader", "Aliases: buy"}},
+		{"chart", []string{"Usage: chart <symbol> [1m|1y]", "Send chart"}},
+		{"sell", []string{`Unknown command "sell"`}},
+	}
+	for _, tt := range tests {
+		got := c.Help(tt.name)
+		if want := strings.Join(tt.want, "\n"); got != want {
+			t.Errorf("Help(%q) = %q, want %q", tt.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+//go:build goolm
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"go.mau.fi/util/dbutil"
+	_ "modernc.org/sqlite"
+
+	"maunium.net/go/mautrix/crypto/cryptohelper"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+// CryptoConfig configures end-to-end encryption of the Matrix bot
+type CryptoConfig struct {
+	Store       string // SQLite database of keys and sessions
+	PickleKey   string // Encrypts the keys in the store
+	RecoveryKey string // Cross-signs the bot's device, optional
+	MinTrust    string // Minimum trust of devices to share keys with, e.g. cross-signed-tofu, optional
+}
+
+// EnableCrypto makes the bot read and post in encrypted rooms. The returned closer closes the store.
+func (b *Bot) EnableCrypto(ctx context.Context, config CryptoConfig) (io.Closer, error) {
+	if config.PickleKey == "" {
+		return nil, fmt.Errorf("Pickle key is not set")
+	}
+	// The access token belongs to a device, keys are tied to it
+	whoami, err := b.client.Whoami(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b.client.DeviceID = whoami.DeviceID
+
+	db, err := dbutil.NewWithDialect("file:"+config.Store+"?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)", "sqlite")
+	if err != nil {
+		return nil, err
+	}
+	helper, err := cryptohelper.NewCryptoHelper(b.client, []byte(config.PickleKey), db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	helper.DecryptErrorCallback = b.decryptError
+	if err := helper.Init(ctx); err != nil {
+		helper.Close()
+		return nil, err
+	}
+	b.client.Crypto = helper
+
+	mach := helper.Machine()
+	if config.MinTrust != "" {
+		trust := id.ParseTrustState(config.MinTrust)
+		if trust == id.TrustStateInvalid {
+			helper.Close()
+			return nil, fmt.Errorf("Invalid trust state: %s", config.MinTrust)
+		}
+		mach.ShareKeysMinTrust = trust
+		mach.SendKeysMinTrust = trust
+	}
+
+	// Verify the bot's device with the recovery key, so users see it as trusted
+	if config.RecoveryKey != "" {
+		keyID, keyData, err := mach.SSSS.GetDefaultKeyData(ctx)
+		if err != nil {
+			helper.Close()
+			return nil, fmt.Errorf("Failed to get recovery key data: %v", err)
+		}
+		key, err := keyData.VerifyRecoveryKey(keyID, config.RecoveryKey)
+		if err != nil {
+			helper.Close()
+			return nil, fmt.Errorf("Invalid recovery key: %v", err)
+		}
+		if err := mach.FetchCrossSigningKeysFromSSSS(ctx, key); err != nil {
+			helper.Close()
+			return nil, fmt.Errorf("Failed to fetch cross-signing keys: %v", err)
+		}
+		if err := mach.SignOwnDevice(ctx, mach.OwnIdentity()); err != nil {
+			helper.Close()
+			return nil, fmt.Errorf("Failed to sign device: %v", err)
+		}
+		if err := mach.SignOwnMasterKey(ctx); err != nil {
+			helper.Close()
+			return nil, fmt.Errorf("Failed to sign master key: %v", err)
+		}
+	}
+	return helper, nil
+}
+
+// decryptError warns the room when a message cannot be decrypted, e.g. the sender's device does not trust the bot
+func (b *Bot) decryptError(evt *event.Event, err error) {
+	if evt.Timestamp < b.startTime.UnixMilli() {
+		return
+	}
+	b.outbox.Enqueue(evt.RoomID, event.EventMessage, &event.MessageEventContent{
+		MsgType: event.MsgNotice,
+		Body:    fmt.Sprintf("Failed to decrypt message from %s, verify the bot's device %s and send it again: %v", evt.Sender, b.client.DeviceID, err),
+	}, nil)
+}
@@ -0,0 +1,21 @@
+//go:build !goolm
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+type CryptoConfig struct {
+	Store       string
+	PickleKey   string
+	RecoveryKey string
+	MinTrust    string
+}
+
+// EnableCrypto fails, E2EE needs the goolm build tag
+func (b *Bot) EnableCrypto(ctx context.Context, config CryptoConfig) (io.Closer, error) {
+	return nil, fmt.Errorf("E2EE is not supported by this build, build with -tags goolm")
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// SetDashboard records the message ID of the room's dashboard
+func (s *Storage) SetDashboard(room string, dashboardId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dashboards[room] = dashboardId
+	return s.saveDashboards()
+}
+
+func (s *Storage) DelDashboard(room string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.dashboards, room)
+	return s.saveDashboards()
+}
+
+// GetDashboards returns the dashboard message IDs by room
+func (s *Storage) GetDashboards() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ret := make(map[string]string, len(s.dashboards))
+	for k, v := range s.dashboards {
+		ret[k] = v
+	}
+	return ret
+}
+
+func (s *Storage) saveDashboards() error {
+	if s.dashboardFilename == "" {
+		return nil
+	}
+	buf, err := json.Marshal(s.dashboards)
+	if err != nil {
+		return err
+	}
+	return writeFile(s.dashboardFilename, buf)
+}
+
+func (s *Storage) loadDashboards() error {
+	s.dashboards = map[string]string{}
+	buf, err := os.ReadFile(s.dashboardFilename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, &s.dashboards)
+}
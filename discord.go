@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DISCORD_API_URL       = "https://discord.com/api/v10"
+	DISCORD_POLL_INTERVAL = 5 * time.Second
+	DISCORD_EPOCH         = 1420070400000 // milliseconds
+)
+
+type DiscordBot struct {
+	apiURL    string
+	token     string
+	channelId string
+	client    *http.Client
+	msg       chan Message
+	interval  time.Duration
+	after     string
+}
+
+type discordMessage struct {
+	Id      string `json:"id"`
+	Content string `json:"content"`
+	Author  struct {
+		Id  string `json:"id"`
+		Bot bool   `json:"bot"`
+	} `json:"author"`
+}
+
+func NewDiscordBot(apiURL string, token string, channelId string) *DiscordBot {
+	if apiURL == "" {
+		apiURL = DISCORD_API_URL
+	}
+	return &DiscordBot{
+		apiURL:    strings.TrimRight(apiURL, "/"),
+		token:     token,
+		channelId: channelId,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		msg:       make(chan Message, 100),
+		interval:  DISCORD_POLL_INTERVAL,
+		// Snowflake of the start time, so older messages are skipped
+		after: strconv.FormatInt((time.Now().UnixMilli()-DISCORD_EPOCH)<<22, 10),
+	}
+}
+
+func (b *DiscordBot) call(ctx context.Context, method string, path string, contentType string, body io.Reader, result any) error {
+	req, err := http.NewRequestWithContext(ctx, method, b.apiURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bot "+b.token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s (HTTP %d)", strings.TrimSpace(string(msg)), resp.StatusCode)
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+func (b *DiscordBot) Run(ctx context.Context) error {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		messages := []discordMessage{}
+		query := url.Values{"after": {b.after}, "limit": {"50"}}
+		if err := b.call(ctx, http.MethodGet, "/channels/"+b.channelId+"/messages?"+query.Encode(), "", nil, &messages); err != nil {
+			continue
+		}
+		// Messages are returned newest first
+		slices.Reverse(messages)
+		for _, m := range messages {
+			b.after = m.Id
+			if m.Author.Bot {
+				continue
+			}
+			b.msg <- Message{Sender: "discord:" + m.Author.Id, Body: m.Content}
+		}
+	}
+}
+
+func (b *DiscordBot) Message() <-chan Message {
+	return b.msg
+}
+
+// Room always fails, the bot only polls and posts in its configured channel
+func (b *DiscordBot) Room(room string) (Notifier, bool) {
+	return nil, false
+}
+
+func (b *DiscordBot) SendText(msg string) error {
+	body, _ := json.Marshal(map[string]string{"content": msg})
+	return b.call(context.Background(), http.MethodPost, "/channels/"+b.channelId+"/messages", "application/json", bytes.NewReader(body), nil)
+}
+
+func (b *DiscordBot) SendCode(msg string) error {
+	return b.SendText("```\n" + msg + "\n```")
+}
+
+func (b *DiscordBot) SendHtml(text string, html string) error {
+	return b.SendText(text)
+}
+
+func (b *DiscordBot) SendTable(table Table) error {
+	return b.SendCode(renderTable(table))
+}
+
+func (b *DiscordBot) Thread(thread string) Notifier {
+	return b
+}
+
+func (b *DiscordBot) SendDashboard(dashboardId string, table Table) (string, error) {
+	return "", errDashboardUnsupported
+}
+
+func (b *DiscordBot) SendSignal(signal Signal, symbol string, price float64, msg string) error {
+	return b.SendText(msg)
+}
+
+func (b *DiscordBot) SendImage(buf []byte, contentType string, filename string) error {
+	return b.SendFile(buf, contentType, filename)
+}
+
+func (b *DiscordBot) SendFile(buf []byte, contentType string, filename string) error {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	payload, _ := json.Marshal(map[string]any{
+		"attachments": []map[string]any{{"id": 0, "filename": filename}},
+	})
+	w.WriteField("payload_json", string(payload))
+	part, err := w.CreateFormFile("files[0]", filename)
+	if err != nil {
+		return err
+	}
+	part.Write(buf)
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return b.call(context.Background(), http.MethodPost, "/channels/"+b.channelId+"/messages", w.FormDataContentType(), body, nil)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDiscordSend(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("Authorization") != "Bot token" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		if r.Method != http.MethodPost || r.URL.Path != "/channels/C1/messages" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "Unknown Channel", "code": 10003}`))
+			return
+		}
+		if r.Header.Get("Content-Type") == "application/json" {
+			req := map[string]string{}
+			json.NewDecoder(r.Body).Decode(&req)
+			if req["content"] != "buy AAPL" {
+				t.Errorf("Got message %v", req)
+			}
+			w.Write([]byte(`{"id": "1"}`))
+			return
+		}
+		payload := struct {
+			Attachments []struct {
+				Id       int    `json:"id"`
+				Filename string `json:"filename"`
+			} `json:"attachments"`
+		}{}
+		if err := json.Unmarshal([]byte(r.FormValue("payload_json")), &payload); err != nil || len(payload.Attachments) != 1 || payload.Attachments[0].Filename != "AAPL.csv" {
+			t.Errorf("Got payload %q", r.FormValue("payload_json"))
+		}
+		f, h, err := r.FormFile("files[0]")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		buf, _ := io.ReadAll(f)
+		if h.Filename != "AAPL.csv" || string(buf) != "a,b\n" {
+			t.Errorf("Got file %s: %q", h.Filename, buf)
+		}
+		w.Write([]byte(`{"id": "2"}`))
+	}))
+	defer srv.Close()
+
+	b := NewDiscordBot(srv.URL, "token", "C1")
+	if err := b.SendText("buy AAPL"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SendFile([]byte("a,b\n"), "text/csv", "AAPL.csv"); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("Got %d calls, want 2", calls)
+	}
+	b.channelId = "C2"
+	if err := b.SendText("buy AAPL"); err == nil || err.Error() != `{"message": "Unknown Channel", "code": 10003} (HTTP 404)` {
+		t.Errorf("Got error %v", err)
+	}
+}
+
+func TestDiscordPoll(t *testing.T) {
+	mu := sync.Mutex{}
+	after := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/channels/C1/messages" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+		}
+		mu.Lock()
+		after = append(after, r.URL.Query().Get("after"))
+		first := len(after) == 1
+		mu.Unlock()
+		if !first {
+			w.Write([]byte(`[]`))
+			return
+		}
+		// Newest first
+		w.Write([]byte(`[
+			{"id": "103", "content": "quote AAPL", "author": {"id": "U2"}},
+			{"id": "102", "content": "buy AAPL", "author": {"id": "B1", "bot": true}},
+			{"id": "101", "content": "add AAPL", "author": {"id": "U1"}}
+		]`))
+	}))
+	defer srv.Close()
+
+	b := NewDiscordBot(srv.URL, "token", "C1")
+	b.interval = 10 * time.Millisecond
+	start := b.after
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- b.Run(ctx) }()
+
+	for _, want := range []Message{{Sender: "discord:U1", Body: "add AAPL"}, {Sender: "discord:U2", Body: "quote AAPL"}} {
+		select {
+		case msg := <-b.Message():
+			if msg != want {
+				t.Errorf("Got message %+v, want %+v", msg, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("No message received")
+		}
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		mu.Lock()
+		n := len(after)
+		mu.Unlock()
+		if n >= 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run returned %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(after) < 2 || after[0] != start || after[1] != "103" {
+		t.Errorf("Got after %v", after)
+	}
+}
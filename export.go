@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// ExportRow is a candle with its indicators, which are nil before their lookback
+type ExportRow struct {
+	Timestamp  time.Time `parquet:"timestamp,timestamp(millisecond)"`
+	Open       float64   `parquet:"open"`
+	High       float64   `parquet:"high"`
+	Low        float64   `parquet:"low"`
+	Close      float64   `parquet:"close"`
+	Volume     float64   `parquet:"volume"`
+	SMA        *float64  `parquet:"sma,optional"`
+	RSI        *float64  `parquet:"rsi,optional"`
+	MACD       *float64  `parquet:"macd,optional"`
+	MACDSignal *float64  `parquet:"macd_signal,optional"`
+	MACDHist   *float64  `parquet:"macd_hist,optional"`
+	BBH        *float64  `parquet:"bbh,optional"`
+	BBM        *float64  `parquet:"bbm,optional"`
+	BBL        *float64  `parquet:"bbl,optional"`
+	StochK     *float64  `parquet:"stoch_k,optional"`
+	StochD     *float64  `parquet:"stoch_d,optional"`
+	MFI        *float64  `parquet:"mfi,optional"`
+	ADX        *float64  `parquet:"adx,optional"`
+}
+
+var exportHeader = []string{"timestamp", "open", "high", "low", "close", "volume", "sma", "rsi", "macd", "macd_signal", "macd_hist", "bbh", "bbm", "bbl", "stoch_k", "stoch_d", "mfi", "adx"}
+
+var exportContentTypes = map[string]string{
+	"csv":     "text/csv",
+	"parquet": "application/vnd.apache.parquet",
+}
+
+// Export encodes rows as csv or parquet and returns the data with its content type
+func Export(rows []ExportRow, format string) ([]byte, string, error) {
+	buf := &bytes.Buffer{}
+	switch format {
+	case "csv":
+		w := csv.NewWriter(buf)
+		w.Write(exportHeader)
+		for _, r := range rows {
+			record := []string{r.Timestamp.Format(time.RFC3339)}
+			for _, v := range []float64{r.Open, r.High, r.Low, r.Close, r.Volume} {
+				record = append(record, strconv.FormatFloat(v, 'f', -1, 64))
+			}
+			// Undefined indicators are empty cells
+			for _, v := range []*float64{r.SMA, r.RSI, r.MACD, r.MACDSignal, r.MACDHist, r.BBH, r.BBM, r.BBL, r.StochK, r.StochD, r.MFI, r.ADX} {
+				if v == nil {
+					record = append(record, "")
+				} else {
+					record = append(record, strconv.FormatFloat(*v, 'f', -1, 64))
+				}
+			}
+			w.Write(record)
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return nil, "", err
+		}
+	case "parquet":
+		if err := parquet.Write(buf, rows); err != nil {
+			return nil, "", err
+		}
+	default:
+		return nil, "", fmt.Errorf("Unknown format: %s", format)
+	}
+	return buf.Bytes(), exportContentTypes[format], nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestExportUndefinedIndicators(t *testing.T) {
+	s := fallingStorage(t, 60)
+	rows := s.GetExportRows("AAPL")
+	if len(rows) != 60 {
+		t.Fatalf("Got %d rows", len(rows))
+	}
+
+	buf, _, err := Export(rows, "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(buf)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	column := map[string]int{}
+	for i, name := range records[0] {
+		column[name] = i
+	}
+	tests := []struct {
+		name     string
+		lookback int
+	}{
+		{"sma", 60},
+		{"rsi", 14},
+		{"macd", 33},
+		{"bbh", 49},
+		{"stoch_k", 17},
+		{"adx", 27},
+	}
+	for _, tt := range tests {
+		for i, record := range records[1:] {
+			if empty := record[column[tt.name]] == ""; empty != (i < tt.lookback) {
+				t.Errorf("%s[%d] = %q, want empty only before %d", tt.name, i, record[column[tt.name]], tt.lookback)
+				break
+			}
+		}
+	}
+	// Closing at the low is a real zero
+	if k := records[len(records)-1][column["stoch_k"]]; k != "0" {
+		t.Errorf("Last stoch_k = %q, want 0", k)
+	}
+
+	buf, _, err = Export(rows, "parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := parquet.Read[ExportRow](bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 60 || read[0].BBH != nil || read[0].SMA != nil || read[59].SMA != nil {
+		t.Errorf("Got undefined indicators %+v", read[0])
+	}
+	if read[59].BBH == nil || read[59].StochK == nil || *read[59].StochK != 0 {
+		t.Errorf("Got defined indicators %+v", read[59])
+	}
+}
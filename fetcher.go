@@ -2,12 +2,26 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
 	"sync"
 	"time"
 
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
 	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
 	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata/stream"
+	"golang.org/x/time/rate"
+)
+
+const (
+	FETCH_RATE    = 3 // requests per second
+	FETCH_BURST   = 3
+	FETCH_RETRIES = 5
+	FETCH_BACKOFF = time.Second
+	NEWS_DAYS     = 30
 )
 
 type StreamData struct {
@@ -17,30 +31,44 @@ type StreamData struct {
 
 type Fetcher struct {
 	stream        chan StreamData
+	news          chan News
 	client        *marketdata.Client
 	stream_client *stream.StocksClient
+	news_client   *stream.NewsClient
+	limiter       *rate.Limiter
 	mu            sync.Mutex
 }
 
-func NewFetcher(apiKey string, secretKey string) *Fetcher {
+// NewFetcher creates a fetcher, baseURL overrides the market data API, e.g. for a proxy or tests
+func NewFetcher(apiKey string, secretKey string, baseURL string) *Fetcher {
 	return &Fetcher{
 		stream: make(chan StreamData, 100),
+		news:   make(chan News, 100),
 		client: marketdata.NewClient(marketdata.ClientOpts{
 			APIKey:    apiKey,
 			APISecret: secretKey,
+			BaseURL:   baseURL,
 			Feed:      marketdata.IEX,
+			// Negative disables the client's own retries, retry backs off and shares the rate limit
+			RetryLimit: -1,
 		}),
 		stream_client: stream.NewStocksClient(marketdata.IEX, stream.WithCredentials(apiKey, secretKey), stream.WithLogger(stream.ErrorOnlyLogger())),
+		news_client:   stream.NewNewsClient(stream.WithCredentials(apiKey, secretKey), stream.WithLogger(stream.ErrorOnlyLogger())),
+		limiter:       rate.NewLimiter(FETCH_RATE, FETCH_BURST),
 	}
 }
 
-func (f *Fetcher) Fetch(symbol string, start time.Time, end time.Time) ([]Candle, error) {
-	bars, err := f.client.GetBars(symbol, marketdata.GetBarsRequest{
-		TimeFrame:  marketdata.OneDay,
-		Start:      start,
-		End:        end,
-		Adjustment: marketdata.All,
-		PageLimit:  10000,
+func (f *Fetcher) Fetch(ctx context.Context, symbol string, start time.Time, end time.Time) ([]Candle, error) {
+	var bars []marketdata.Bar
+	err := f.retry(ctx, func() (err error) {
+		bars, err = f.client.GetBars(symbol, marketdata.GetBarsRequest{
+			TimeFrame:  marketdata.OneDay,
+			Start:      start,
+			End:        end,
+			Adjustment: marketdata.All,
+			PageLimit:  10000,
+		})
+		return err
 	})
 	if err != nil {
 		return nil, err
@@ -57,6 +85,115 @@ func (f *Fetcher) Fetch(symbol string, start time.Time, end time.Time) ([]Candle
 	return candles, nil
 }
 
+func (f *Fetcher) FetchNews(ctx context.Context, symbol string, start time.Time, end time.Time) ([]News, error) {
+	var articles []marketdata.News
+	err := f.retry(ctx, func() (err error) {
+		articles, err = f.client.GetNews(marketdata.GetNewsRequest{
+			Symbols:    []string{symbol},
+			Start:      start,
+			End:        end,
+			TotalLimit: 50,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	news := make([]News, len(articles))
+	for k, v := range articles {
+		news[k] = News{
+			ID:        v.ID,
+			CreatedAt: v.CreatedAt,
+			Author:    v.Author,
+			Headline:  v.Headline,
+			Summary:   v.Summary,
+			URL:       v.URL,
+			Symbols:   v.Symbols,
+		}
+	}
+	return news, nil
+}
+
+type Quote struct {
+	Symbol    string
+	Timestamp time.Time
+	BidPrice  float64
+	BidSize   float64
+	AskPrice  float64
+	AskSize   float64
+	LastPrice float64
+	LastSize  float64
+	PrevClose float64
+	Change    float64
+	Volume    float64
+}
+
+func (f *Fetcher) Quote(ctx context.Context, symbol string) (*Quote, error) {
+	var snapshot *marketdata.Snapshot
+	err := f.retry(ctx, func() (err error) {
+		snapshot, err = f.client.GetSnapshot(symbol, marketdata.GetSnapshotRequest{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if snapshot == nil || snapshot.LatestTrade == nil {
+		return nil, fmt.Errorf("No snapshot for %s", symbol)
+	}
+	q := &Quote{
+		Symbol:    symbol,
+		Timestamp: snapshot.LatestTrade.Timestamp,
+		LastPrice: snapshot.LatestTrade.Price,
+		LastSize:  float64(snapshot.LatestTrade.Size),
+	}
+	if snapshot.LatestQuote != nil {
+		q.BidPrice = snapshot.LatestQuote.BidPrice
+		q.BidSize = float64(snapshot.LatestQuote.BidSize)
+		q.AskPrice = snapshot.LatestQuote.AskPrice
+		q.AskSize = float64(snapshot.LatestQuote.AskSize)
+	}
+	if snapshot.DailyBar != nil {
+		q.Volume = float64(snapshot.DailyBar.Volume)
+	}
+	if snapshot.PrevDailyBar != nil && snapshot.PrevDailyBar.Close > 0 {
+		q.PrevClose = snapshot.PrevDailyBar.Close
+		q.Change = q.LastPrice/q.PrevClose*100 - 100
+	}
+	return q, nil
+}
+
+// retry calls fn through the shared rate limiter and retries retryable errors
+func (f *Fetcher) retry(ctx context.Context, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		if err := f.limiter.Wait(ctx); err != nil {
+			return err
+		}
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if attempt >= FETCH_RETRIES || !retryable(err) {
+			return err
+		}
+		// Exponential backoff with jitter
+		backoff := FETCH_BACKOFF << attempt
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff/2 + rand.N(backoff/2)):
+		}
+	}
+}
+
+func retryable(err error) bool {
+	var apiErr *alpaca.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
 func (f *Fetcher) handler(bar stream.Bar) {
 	f.stream <- StreamData{
 		Symbol: bar.Symbol,
@@ -71,8 +208,23 @@ func (f *Fetcher) handler(bar stream.Bar) {
 	}
 }
 
+func (f *Fetcher) newsHandler(news stream.News) {
+	f.news <- News{
+		ID:        news.ID,
+		CreatedAt: news.CreatedAt,
+		Author:    news.Author,
+		Headline:  news.Headline,
+		Summary:   news.Summary,
+		URL:       news.URL,
+		Symbols:   news.Symbols,
+	}
+}
+
 func (f *Fetcher) Connect(ctx context.Context) error {
-	return f.stream_client.Connect(ctx)
+	if err := f.stream_client.Connect(ctx); err != nil {
+		return err
+	}
+	return f.news_client.Connect(ctx)
 }
 
 func (f *Fetcher) Run(ctx context.Context) error {
@@ -82,22 +234,39 @@ func (f *Fetcher) Run(ctx context.Context) error {
 			return ctx.Err()
 		case err := <-f.stream_client.Terminated():
 			return fmt.Errorf("Terminated: %v", err)
+		case err := <-f.news_client.Terminated():
+			return fmt.Errorf("News terminated: %v", err)
 		}
 	}
 }
 
+// Sub subscribes to the symbol's bars and news, or neither
 func (f *Fetcher) Sub(symbol string) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	return f.stream_client.SubscribeToDailyBars(f.handler, symbol)
+	if err := f.stream_client.SubscribeToDailyBars(f.handler, symbol); err != nil {
+		return err
+	}
+	if err := f.news_client.SubscribeToNews(f.newsHandler, symbol); err != nil {
+		if unsubErr := f.stream_client.UnsubscribeFromDailyBars(symbol); unsubErr != nil {
+			return errors.Join(err, unsubErr)
+		}
+		return err
+	}
+	return nil
 }
 
+// Unsub unsubscribes from the symbol's bars and news, a failure of one doesn't keep the other
 func (f *Fetcher) Unsub(symbol string) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	return f.stream_client.UnsubscribeFromDailyBars(symbol)
+	return errors.Join(f.stream_client.UnsubscribeFromDailyBars(symbol), f.news_client.UnsubscribeFromNews(symbol))
 }
 
 func (f *Fetcher) Stream() <-chan StreamData {
 	return f.stream
 }
+
+func (f *Fetcher) News() <-chan News {
+	return f.news
+}
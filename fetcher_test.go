@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetcherQuote(t *testing.T) {
+	tests := []struct {
+		name     string
+		snapshot string
+		want     Quote
+		err      bool
+	}{
+		{
+			name: "full",
+			snapshot: `{"AAPL": {
+				"latestTrade": {"t": "2024-03-01T15:30:00Z", "p": 110, "s": 50},
+				"latestQuote": {"t": "2024-03-01T15:30:00Z", "bp": 109.9, "bs": 3, "ap": 110.1, "as": 4},
+				"dailyBar": {"t": "2024-03-01T05:00:00Z", "o": 101, "h": 111, "l": 100, "c": 110, "v": 123456},
+				"prevDailyBar": {"t": "2024-02-29T05:00:00Z", "o": 99, "h": 102, "l": 98, "c": 100, "v": 100000}
+			}}`,
+			want: Quote{
+				Symbol:    "AAPL",
+				Timestamp: time.Date(2024, 3, 1, 15, 30, 0, 0, time.UTC),
+				BidPrice:  109.9,
+				BidSize:   3,
+				AskPrice:  110.1,
+				AskSize:   4,
+				LastPrice: 110,
+				LastSize:  50,
+				PrevClose: 100,
+				Change:    10,
+				Volume:    123456,
+			},
+		},
+		{
+			name:     "trade only",
+			snapshot: `{"AAPL": {"latestTrade": {"t": "2024-03-01T15:30:00Z", "p": 110, "s": 50}}}`,
+			want: Quote{
+				Symbol:    "AAPL",
+				Timestamp: time.Date(2024, 3, 1, 15, 30, 0, 0, time.UTC),
+				LastPrice: 110,
+				LastSize:  50,
+			},
+		},
+		{
+			name:     "no trade",
+			snapshot: `{"AAPL": {"dailyBar": {"t": "2024-03-01T05:00:00Z", "c": 110}}}`,
+			err:      true,
+		},
+		{
+			name:     "unknown symbol",
+			snapshot: `{}`,
+			err:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v2/stocks/snapshots" || r.URL.Query().Get("symbols") != "AAPL" {
+					t.Errorf("Unexpected request %s", r.URL)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tt.snapshot))
+			}))
+			defer srv.Close()
+
+			q, err := NewFetcher("key", "secret", srv.URL).Quote(context.Background(), "AAPL")
+			if tt.err {
+				if err == nil {
+					t.Fatalf("Expected error, got %+v", q)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(q.Change-tt.want.Change) > 1e-9 {
+				t.Errorf("Change = %v, want %v", q.Change, tt.want.Change)
+			}
+			q.Change = tt.want.Change
+			if !q.Timestamp.Equal(tt.want.Timestamp) {
+				t.Errorf("Timestamp = %v, want %v", q.Timestamp, tt.want.Timestamp)
+			}
+			q.Timestamp = tt.want.Timestamp
+			if *q != tt.want {
+				t.Errorf("Quote = %+v, want %+v", *q, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetcherRetry(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			http.Error(w, `{"message": "too many requests"}`, http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"AAPL": {"latestTrade": {"t": "2024-03-01T15:30:00Z", "p": 110, "s": 50}}}`))
+	}))
+	defer srv.Close()
+
+	if _, err := NewFetcher("key", "secret", srv.URL).Quote(context.Background(), "AAPL"); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("Got %d requests, want 2", calls)
+	}
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var symbolArg = Arg{Name: "symbol", Type: ArgSymbol}
+
+// FetchError is a failure of the market data API while adding a ticker
+type FetchError struct {
+	Symbol string
+	Err    error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("Failed to fetch candles for %s: %v", e.Symbol, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+var errNoCandles = errors.New("No candles fetched")
+
+// inFlight is the set of background fetches in progress, so they aren't started twice
+type inFlight struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+// start marks the key in progress, it reports false if it already was
+func (f *inFlight) start(key string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.keys[key] {
+		return false
+	}
+	if f.keys == nil {
+		f.keys = map[string]bool{}
+	}
+	f.keys[key] = true
+	return true
+}
+
+func (f *inFlight) done(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.keys, key)
+}
+
+// watchTicker adds the symbol to the room's watchlist. New tickers are fetched before they are
+// stored, so unknown symbols are rejected, and subscribed to afterwards.
+func watchTicker(ctx context.Context, storage *Storage, fetcher *Fetcher, live *Live, webhooks *Webhooks, room string, symbol string, buyPrice float64) error {
+	// Tickers watched by another room already have history and a subscription
+	if storage.HasTicker(symbol) {
+		if _, err := storage.Watch(room, symbol, buyPrice); err != nil {
+			return fmt.Errorf("Failed to add %s: %v", symbol, err)
+		}
+		publishCandle(live, storage, symbol)
+		sendFill(webhooks, storage, room, symbol)
+		return nil
+	}
+	candles, err := fetcher.Fetch(ctx, symbol, time.Now().AddDate(0, 0, -DAYS), time.Now())
+	if err != nil {
+		return &FetchError{Symbol: symbol, Err: err}
+	}
+	if len(candles) == 0 {
+		return fmt.Errorf("%w for %s", errNoCandles, symbol)
+	}
+	if _, err := storage.Watch(room, symbol, buyPrice); err != nil {
+		return fmt.Errorf("Failed to add %s: %v", symbol, err)
+	}
+	storage.InsertCandles(symbol, candles...)
+	if news, err := fetcher.FetchNews(ctx, symbol, time.Now().AddDate(0, 0, -NEWS_DAYS), time.Now()); err == nil {
+		storage.InsertNews(symbol, news...)
+	}
+	publishCandle(live, storage, symbol)
+	sendFill(webhooks, storage, room, symbol)
+	if err := fetcher.Sub(symbol); err != nil {
+		return fmt.Errorf("Failed to subscribe to %s: %v", symbol, err)
+	}
+	return nil
+}
+
+// sendFill posts the room's buy price of the symbol as a fill, if it has one
+func sendFill(webhooks *Webhooks, storage *Storage, room string, symbol string) {
+	row, ok := storage.GetRoomTickerRow(room, symbol)
+	if !ok || !(row.BuyPrice > 0) {
+		return
+	}
+	webhooks.Send(WebhookEvent{Event: WebhookFill, Timestamp: time.Now(), Room: room, TickerTable: row})
+}
+
+// unwatchTicker removes the symbol from the room's watchlist, keeping the subscription while
+// other rooms watch it
+func unwatchTicker(storage *Storage, fetcher *Fetcher, live *Live, room string, symbol string) error {
+	unwatched, err := storage.Unwatch(room, symbol)
+	if err != nil {
+		return err
+	}
+	if unwatched {
+		fetcher.Unsub(symbol)
+		live.Publish(LiveRemove, []string{symbol}, LiveRemoveEvent{Symbol: symbol})
+	} else {
+		publishCandle(live, storage, symbol)
+	}
+	return nil
+}
+
+// registerCommands adds the chat commands to the registry
+func registerCommands(commands *Commands, ctx context.Context, cancel context.CancelFunc, storage *Storage, fetcher *Fetcher, scheduler *Scheduler, live *Live, webhooks *Webhooks) {
+	adding := &inFlight{}
+	refetching := &inFlight{}
+	commands.Register(&Command{
+		Name:    "help",
+		Aliases: []string{"?"},
+		Args:    []Arg{{Name: "command", Optional: true}},
+		Help:    "List commands or show help for a command",
+		Run: func(req *Request, args Args) error {
+			req.Reply.SendText(commands.Help(args.String("command")))
+			return nil
+		},
+	})
+	commands.Register(&Command{
+		Name: "stop",
+		Help: "Stop the bot",
+		Role: RoleAdmin,
+		Run: func(req *Request, args Args) error {
+			cancel()
+			return nil
+		},
+	})
+	commands.Register(&Command{
+		Name: "add",
+		Args: []Arg{symbolArg, {Name: "buy price", Type: ArgFloat, Optional: true}},
+		Help: "Add ticker to this room's watchlist, fetch its history and subscribe to live bars",
+		Role: RoleTrader,
+		Run: func(req *Request, args Args) error {
+			symbol := args.String("symbol")
+			if storage.HasTicker(symbol) {
+				return watchTicker(ctx, storage, fetcher, live, webhooks, req.Room, symbol, args.Float("buy price"))
+			}
+			// New tickers are fetched in the background, the main loop doesn't wait for retries
+			if !adding.start(symbol) {
+				return fmt.Errorf("Already adding %s", symbol)
+			}
+			go func() {
+				defer adding.done(symbol)
+				if err := watchTicker(ctx, storage, fetcher, live, webhooks, req.Room, symbol, args.Float("buy price")); err != nil {
+					req.Reply.SendText(err.Error())
+					return
+				}
+				req.Reply.SendText(fmt.Sprintf("Added %s", symbol))
+			}()
+			return nil
+		},
+	})
+	commands.Register(&Command{
+		Name:    "rm",
+		Aliases: []string{"remove", "del"},
+		Args:    []Arg{symbolArg},
+		Help:    "Remove ticker from this room's watchlist",
+		Role:    RoleTrader,
+		Run: func(req *Request, args Args) error {
+			return unwatchTicker(storage, fetcher, live, req.Room, args.String("symbol"))
+		},
+	})
+	commands.Register(&Command{
+		Name:    "mute",
+		Aliases: []string{"snooze"},
+		Args:    []Arg{{Name: "symbol|all", Type: ArgTarget}, {Name: "duration", Type: ArgDuration, Optional: true}},
+		Help:    "Mute alerts of a ticker or all tickers in this room, for a day by default, e.g. mute AAPL 2d",
+		Run: func(req *Request, args Args) error {
+			symbol := args.String("symbol|all")
+			if symbol != ALL_SYMBOLS && !storage.IsWatched(req.Room, symbol) {
+				return fmt.Errorf("Unknown symbol %s", symbol)
+			}
+			duration := MUTE_DURATION
+			if args.Has("duration") {
+				duration = args.Duration("duration")
+			}
+			until := time.Now().Add(duration)
+			if err := storage.Mute(req.Room, symbol, until); err != nil {
+				return fmt.Errorf("Failed to mute %s: %v", symbol, err)
+			}
+			if symbol == ALL_SYMBOLS {
+				symbol = "all tickers"
+			}
+			return req.Reply.SendText(fmt.Sprintf("Muted %s until %s", symbol, until.In(marketLocation).Format(time.DateTime)))
+		},
+	})
+	commands.Register(&Command{
+		Name: "unmute",
+		Args: []Arg{{Name: "symbol|all", Type: ArgTarget}},
+		Help: "Unmute alerts of a ticker, or the mute of all tickers, in this room",
+		Run: func(req *Request, args Args) error {
+			return storage.Unmute(req.Room, args.String("symbol|all"))
+		},
+	})
+	commands.Register(&Command{
+		Name:    "ind",
+		Aliases: []string{"indicators"},
+		Args:    []Arg{symbolArg},
+		Help:    "Print latest indicators",
+		Run: func(req *Request, args Args) error {
+			symbol := args.String("symbol")
+			if !storage.HasTicker(symbol) {
+				return fmt.Errorf("Unknown symbol %s", symbol)
+			}
+			close := storage.GetClose(symbol)
+			bbl, bbm, bbh := storage.GetBB(symbol)
+			stochK, stochD := storage.GetStoch(symbol)
+			mfi := storage.GetMFI(symbol)
+			adx := storage.GetADX(symbol)
+			indicators := fmt.Sprintf("BB(%.02f, %0.2f, %.02f), Stoch(%.02f, %0.2f), MFI(%.02f), ADX(%0.2f)", bbl, bbm, bbh, stochK, stochD, mfi, adx)
+			text := fmt.Sprintf("%s: Close $%.02f, %s", symbol, close, indicators)
+			formatted := fmt.Sprintf("<b>%s</b> %s Close <b>$%.02f</b> %s<br/>%s", htmlSymbol(symbol), htmlSignal(string(storage.GetSignal(symbol))), close, htmlChange(fmt.Sprintf("%+.02f%%", storage.GetDayChange(symbol))), indicators)
+			return req.Reply.SendHtml(text, formatted)
+		},
+	})
+	commands.Register(&Command{
+		Name:    "quote",
+		Aliases: []string{"q"},
+		Args:    []Arg{symbolArg},
+		Help:    "Print latest quote and trade",
+		Run: func(req *Request, args Args) error {
+			symbol := args.String("symbol")
+			q, err := fetcher.Quote(ctx, symbol)
+			if err != nil {
+				return fmt.Errorf("Failed to fetch quote for %s: %v", symbol, err)
+			}
+			text := fmt.Sprintf("%s: Last $%.02f x %.0f, Bid $%.02f x %.0f, Ask $%.02f x %.0f, Change %+.02f%%, Volume %.0f", symbol, q.LastPrice, q.LastSize, q.BidPrice, q.BidSize, q.AskPrice, q.AskSize, q.Change, q.Volume)
+			formatted := fmt.Sprintf("<b>%s</b> Last <b>$%.02f</b> x %.0f %s<br/>Bid $%.02f x %.0f, Ask $%.02f x %.0f, Volume %.0f", htmlSymbol(symbol), q.LastPrice, q.LastSize, htmlChange(fmt.Sprintf("%+.02f%%", q.Change)), q.BidPrice, q.BidSize, q.AskPrice, q.AskSize, q.Volume)
+			return req.Reply.SendHtml(text, formatted)
+		},
+	})
+	commands.Register(&Command{
+		Name: "news",
+		Args: []Arg{symbolArg},
+		Help: "Print latest headlines",
+		Run: func(req *Request, args Args) error {
+			symbol := args.String("symbol")
+			news := storage.GetNews(symbol)
+			if len(news) == 0 {
+				return fmt.Errorf("No news for %s", symbol)
+			}
+			lines := []string{}
+			items := []string{}
+			for i := len(news) - 1; i >= 0 && len(lines) < NEWS_COMMAND_LIMIT; i-- {
+				date := news[i].CreatedAt.Format(time.DateOnly)
+				lines = append(lines, fmt.Sprintf("%s %s %s", date, news[i].Headline, news[i].URL))
+				items = append(items, fmt.Sprintf(`<li>%s <a href="%s">%s</a></li>`, date, html.EscapeString(news[i].URL), html.EscapeString(news[i].Headline)))
+			}
+			return req.Reply.SendHtml(strings.Join(lines, "\n"), "<b>"+htmlSymbol(symbol)+"</b><ul>"+strings.Join(items, "")+"</ul>")
+		},
+	})
+	commands.Register(&Command{
+		Name: "export",
+		Args: []Arg{symbolArg, {Name: "format", Optional: true, Choices: []string{"csv", "parquet"}}},
+		Help: "Upload candles and indicators as a file",
+		Run: func(req *Request, args Args) error {
+			symbol := args.String("symbol")
+			format := "csv"
+			if args.Has("format") {
+				format = args.String("format")
+			}
+			rows := storage.GetExportRows(symbol)
+			if rows == nil {
+				return fmt.Errorf("Unknown symbol %s", symbol)
+			}
+			buf, contentType, err := Export(rows, format)
+			if err != nil {
+				return err
+			}
+			if err := req.Reply.SendFile(buf, contentType, symbol+"."+format); err != nil {
+				return fmt.Errorf("Failed to upload export for %s: %v", symbol, err)
+			}
+			return nil
+		},
+	})
+	commands.Register(&Command{
+		Name: "chart",
+		Args: []Arg{symbolArg, {Name: "days", Type: ArgInt, Optional: true}},
+		Help: "Upload chart image",
+		Run: func(req *Request, args Args) error {
+			days := CHART_DAYS
+			if args.Has("days") {
+				days = args.Int("days")
+			}
+			return sendChart(req.Reply, storage, args.String("symbol"), days)
+		},
+	})
+	commands.Register(&Command{
+		Name:    "ls",
+		Aliases: []string{"list"},
+		Help:    "List tickers of this room's watchlist",
+		Run: func(req *Request, args Args) error {
+			return req.Reply.SendTable(watchlistTable(storage, req.Room))
+		},
+	})
+	commands.Register(&Command{
+		Name: "dashboard",
+		Args: []Arg{{Name: "state", Optional: true, Choices: []string{"on", "off"}}},
+		Help: "Pin the watchlist table and keep it updated on every bar",
+		Role: RoleTrader,
+		Run: func(req *Request, args Args) error {
+			if args.String("state") == "off" {
+				return storage.DelDashboard(req.Room)
+			}
+			// The dashboard lives in the room, not in the command's thread. Posting waits
+			// for its message ID, which must not hold up the main loop.
+			table := watchlistTable(storage, req.Room)
+			go func() {
+				dashboardId, err := req.Reply.Thread("").SendDashboard("", table)
+				if dashboardId != "" {
+					if err := storage.SetDashboard(req.Room, dashboardId); err != nil {
+						req.Reply.SendText(err.Error())
+						return
+					}
+				}
+				if err != nil {
+					req.Reply.SendText(err.Error())
+				}
+			}()
+			return nil
+		},
+	})
+	commands.Register(&Command{
+		Name: "summary",
+		Args: []Arg{{Name: "days", Type: ArgInt, Optional: true}},
+		Help: "Print performance of this room's watchlist over a period",
+		Run: func(req *Request, args Args) error {
+			days := SUMMARY_DAYS
+			if args.Has("days") {
+				days = args.Int("days")
+			}
+			rows := [][]string{}
+			for _, symbol := range storage.GetWatchlist(req.Room) {
+				var changeStr string
+				if buyPrice := storage.GetRoomBuyPrice(req.Room, symbol); buyPrice > 0 {
+					changeStr = fmt.Sprintf("%+.02f%%", storage.GetRoomChange(req.Room, symbol))
+				}
+				rows = append(rows, []string{symbol, fmt.Sprintf("$%.2f", storage.GetClose(symbol)), fmt.Sprintf("%+.02f%%", storage.GetPeriodChange(symbol, days)), changeStr})
+			}
+			return req.Reply.SendTable(Table{
+				Header: []string{"Symbol", "Close", fmt.Sprintf("%dd Change", days), "Change"},
+				Kinds:  []ColumnKind{ColumnSymbol, ColumnText, ColumnChange, ColumnChange},
+				Rows:   rows,
+			})
+		},
+	})
+	commands.Register(&Command{
+		Name: "refetch",
+		Help: "Refetch history candles in the background",
+		Role: RoleTrader,
+		Run: func(req *Request, args Args) error {
+			// Refetches load the market data API, one at a time is enough
+			if !refetching.start("refetch") {
+				return fmt.Errorf("Refetch already running")
+			}
+			go func() {
+				defer refetching.done("refetch")
+				if failed := fetchHistory(ctx, fetcher, storage, storage.GetSymbols()); len(failed) > 0 {
+					req.Reply.SendText(fmt.Sprintf("Failed to refetch history for %d symbols: %s", len(failed), strings.Join(failed, ", ")))
+				}
+			}()
+			return nil
+		},
+	})
+	commands.Register(&Command{
+		Name: "jobs",
+		Help: "List scheduled jobs",
+		Run: func(req *Request, args Args) error {
+			rows := [][]string{}
+			for _, job := range scheduler.Jobs() {
+				var lastRunStr string
+				if !job.LastRun.IsZero() {
+					lastRunStr = job.LastRun.In(marketLocation).Format(time.DateTime)
+				}
+				spec := job.Spec
+				if job.TradingDays {
+					spec = "trading " + spec
+				}
+				rows = append(rows, []string{job.Command, spec, lastRunStr, job.NextRun.In(marketLocation).Format(time.DateTime), strconv.Itoa(job.Runs)})
+			}
+			return req.Reply.SendTable(Table{
+				Header: []string{"Command", "Schedule", "Last Run", "Next Run", "Runs"},
+				Rows:   rows,
+			})
+		},
+	})
+	commands.Register(&Command{
+		Name:    "mem",
+		Aliases: []string{"memory"},
+		Help:    "Print memory stats",
+		Run: func(req *Request, args Args) error {
+			var m runtime.MemStats
+			runtime.ReadMemStats(&m)
+			req.Reply.SendCode(fmt.Sprintf("Alloc = %v MiB\nTotalAlloc = %v MiB\nSys = %v MiB\nNumGC = %v", m.Alloc/1024/1024, m.TotalAlloc/1024/1024, m.Sys/1024/1024, m.NumGC))
+			return nil
+		},
+	})
+}
+
+// watchlistTable returns the ls table of the room's watchlist
+func watchlistTable(storage *Storage, room string) Table {
+	rows := [][]string{}
+	for _, symbol := range storage.GetWatchlist(room) {
+		var buyPriceStr, closeStr, changeStr, signalStr, mutedStr string
+		if buyPrice := storage.GetRoomBuyPrice(room, symbol); buyPrice > 0 {
+			buyPriceStr = fmt.Sprintf("$%.02f", buyPrice)
+			changeStr = fmt.Sprintf("%+.02f%%", storage.GetRoomChange(room, symbol))
+		}
+		closeStr = fmt.Sprintf("$%.2f", storage.GetClose(symbol))
+		signalStr = string(storage.GetSignal(symbol))
+		if until := storage.GetMutedUntil(room, symbol); !until.IsZero() {
+			mutedStr = until.In(marketLocation).Format(time.DateTime)
+		}
+		rows = append(rows, []string{symbol, buyPriceStr, closeStr, changeStr, signalStr, mutedStr})
+	}
+	return Table{
+		Header: []string{"Symbol", "Buy Price", "Close", "Change", "Signal", "Muted Until"},
+		Kinds:  []ColumnKind{ColumnSymbol, ColumnText, ColumnText, ColumnChange, ColumnSignal, ColumnText},
+		Rows:   rows,
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testNotifier passes sent texts to the channel
+type testNotifier struct {
+	texts chan string
+}
+
+func newTestNotifier() *testNotifier {
+	return &testNotifier{texts: make(chan string, 10)}
+}
+
+func (n *testNotifier) Run(ctx context.Context) error    { return nil }
+func (n *testNotifier) Message() <-chan Message          { return nil }
+func (n *testNotifier) SendText(msg string) error        { n.texts <- msg; return nil }
+func (n *testNotifier) SendCode(msg string) error        { return n.SendText(msg) }
+func (n *testNotifier) SendHtml(text, html string) error { return n.SendText(text) }
+func (n *testNotifier) SendTable(table Table) error      { return nil }
+func (n *testNotifier) SendSignal(signal Signal, symbol string, price float64, msg string) error {
+	return n.SendText(msg)
+}
+func (n *testNotifier) SendImage(buf []byte, contentType string, filename string) error { return nil }
+func (n *testNotifier) SendFile(buf []byte, contentType string, filename string) error  { return nil }
+func (n *testNotifier) Room(room string) (Notifier, bool)                               { return n, true }
+func (n *testNotifier) Thread(thread string) Notifier                                   { return n }
+func (n *testNotifier) SendDashboard(dashboardId string, table Table) (string, error) {
+	return "", errDashboardUnsupported
+}
+
+func (n *testNotifier) next(t *testing.T) string {
+	t.Helper()
+	select {
+	case text := <-n.texts:
+		return text
+	case <-time.After(5 * time.Second):
+		t.Fatal("No reply")
+		return ""
+	}
+}
+
+// blockingFetcher serves no bars, holding requests until release is closed
+func blockingFetcher(t *testing.T) (*Fetcher, chan struct{}) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"bars": {}, "next_page_token": null}`))
+	}))
+	t.Cleanup(srv.Close)
+	return NewFetcher("key", "secret", srv.URL), release
+}
+
+func TestAddInBackground(t *testing.T) {
+	fetcher, release := blockingFetcher(t)
+	storage := NewStorage()
+	commands := NewCommands()
+	registerCommands(commands, context.Background(), func() {}, storage, fetcher, nil, NewLive(), NewWebhooks(nil, "", ""))
+	reply := newTestNotifier()
+
+	start := time.Now()
+	if err := commands.Dispatch(Message{Room: DEFAULT_ROOM, Body: "add AAPL"}, reply); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("add took %v", d)
+	}
+	if err := commands.Dispatch(Message{Room: DEFAULT_ROOM, Body: "add AAPL"}, reply); err == nil || err.Error() != "Already adding AAPL" {
+		t.Errorf("Got error %v", err)
+	}
+	close(release)
+	if text := reply.next(t); text != "No candles fetched for AAPL" {
+		t.Errorf("Got reply %q", text)
+	}
+	if storage.IsWatched(DEFAULT_ROOM, "AAPL") {
+		t.Error("Added AAPL without candles")
+	}
+
+	// Done, so it may be added again
+	if err := commands.Dispatch(Message{Room: DEFAULT_ROOM, Body: "add AAPL"}, reply); err != nil {
+		t.Fatal(err)
+	}
+	reply.next(t)
+}
+
+func TestRefetchOnce(t *testing.T) {
+	fetcher, release := blockingFetcher(t)
+	storage := NewStorage()
+	if _, err := storage.Watch(DEFAULT_ROOM, "AAPL", 0); err != nil {
+		t.Fatal(err)
+	}
+	commands := NewCommands()
+	registerCommands(commands, context.Background(), func() {}, storage, fetcher, nil, NewLive(), NewWebhooks(nil, "", ""))
+	reply := newTestNotifier()
+
+	if err := commands.Dispatch(Message{Sender: SCHEDULER, Body: "refetch"}, reply); err != nil {
+		t.Fatal(err)
+	}
+	if err := commands.Dispatch(Message{Room: DEFAULT_ROOM, Body: "refetch"}, reply); err == nil || err.Error() != "Refetch already running" {
+		t.Errorf("Got error %v", err)
+	}
+	close(release)
+	if text := reply.next(t); text != "Failed to refetch history for 1 symbols: AAPL" {
+		t.Errorf("Got reply %q", text)
+	}
+	if err := commands.Dispatch(Message{Room: DEFAULT_ROOM, Body: "refetch"}, reply); err != nil {
+		t.Errorf("Refetch after the first finished: %v", err)
+	}
+	reply.next(t)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"html"
+	"net/url"
+	"strings"
+)
+
+const (
+	COLOR_UP   = "#2e7d32"
+	COLOR_DOWN = "#c62828"
+	COLOR_TEXT = "#ffffff"
+)
+
+// webURL is the address of the web UI, symbols link to their chart when set
+var webURL string
+
+// chartURL returns the web chart of the symbol, or an empty string without a web UI
+func chartURL(symbol string) string {
+	if webURL == "" {
+		return ""
+	}
+	return strings.TrimRight(webURL, "/") + "/#" + url.PathEscape(symbol)
+}
+
+func htmlSymbol(symbol string) string {
+	if u := chartURL(symbol); u != "" {
+		return `<a href="` + html.EscapeString(u) + `">` + html.EscapeString(symbol) + `</a>`
+	}
+	return html.EscapeString(symbol)
+}
+
+// htmlChange colors a formatted change by its sign, e.g. +1.23%
+func htmlChange(change string) string {
+	switch {
+	case strings.HasPrefix(change, "+"):
+		return `<font color="` + COLOR_UP + `">` + html.EscapeString(change) + `</font>`
+	case strings.HasPrefix(change, "-"):
+		return `<font color="` + COLOR_DOWN + `">` + html.EscapeString(change) + `</font>`
+	}
+	return html.EscapeString(change)
+}
+
+func htmlSignal(signal string) string {
+	color := ""
+	switch Signal(signal) {
+	case SignalBuy:
+		color = COLOR_UP
+	case SignalSell:
+		color = COLOR_DOWN
+	default:
+		return html.EscapeString(signal)
+	}
+	return `<span data-mx-bg-color="` + color + `" data-mx-color="` + COLOR_TEXT + `"><b>&nbsp;` + html.EscapeString(strings.ToUpper(signal)) + `&nbsp;</b></span>`
+}
+
+func htmlCell(kind ColumnKind, value string) string {
+	switch kind {
+	case ColumnSymbol:
+		return htmlSymbol(value)
+	case ColumnChange:
+		return htmlChange(value)
+	case ColumnSignal:
+		return htmlSignal(value)
+	}
+	return html.EscapeString(value)
+}
+
+// renderHtmlTable renders the table with styled cells, renderTable is its plain text fallback
+func renderHtmlTable(t Table) string {
+	b := strings.Builder{}
+	b.WriteString("<table><thead><tr>")
+	for _, v := range t.Header {
+		b.WriteString("<th>" + html.EscapeString(v) + "</th>")
+	}
+	b.WriteString("</tr></thead><tbody>")
+	for _, row := range t.Rows {
+		b.WriteString("<tr>")
+		for k, v := range row {
+			b.WriteString("<td>" + htmlCell(t.kind(k), v) + "</td>")
+		}
+		b.WriteString("</tr>")
+	}
+	b.WriteString("</tbody></table>")
+	return b.String()
+}
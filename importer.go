@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata"
+)
+
+// Daily bars from the provider are stamped at midnight New York time
+var marketLocation, _ = time.LoadLocation("America/New_York")
+
+var dateLayouts = []string{
+	time.DateOnly,
+	"20060102",
+	"01/02/2006",
+	"2006/01/02",
+	time.RFC3339,
+	time.DateTime,
+}
+
+// ParseCandles reads OHLCV candles from CSV exports such as Yahoo, Stooq or our own history files
+func ParseCandles(r io.Reader) ([]Candle, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for k, v := range header {
+		name := strings.ToLower(strings.Trim(strings.TrimSpace(v), "<>\ufeff"))
+		switch name {
+		case "date", "timestamp", "time", "datetime":
+			if _, ok := columns["date"]; !ok {
+				columns["date"] = k
+			}
+		case "open", "high", "low", "close":
+			columns[name] = k
+		case "volume", "vol":
+			columns["volume"] = k
+		}
+	}
+	for _, name := range []string{"date", "open", "high", "low", "close"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("Missing column: %s", name)
+		}
+	}
+
+	candles := []Candle{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		c, ok, err := parseRecord(record, columns)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %v", line, err)
+		}
+		if ok {
+			candles = append(candles, c)
+		}
+	}
+	return candles, nil
+}
+
+func parseRecord(record []string, columns map[string]int) (Candle, bool, error) {
+	field := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	// Yahoo exports use "null" for days without trading
+	if field("close") == "" || strings.EqualFold(field("close"), "null") {
+		return Candle{}, false, nil
+	}
+
+	c := Candle{}
+	var err error
+	if c.Timestamp, err = parseDate(field("date")); err != nil {
+		return c, false, err
+	}
+	values := []*float64{&c.Open, &c.High, &c.Low, &c.Close}
+	for k, name := range []string{"open", "high", "low", "close"} {
+		if *values[k], err = strconv.ParseFloat(field(name), 64); err != nil {
+			return c, false, err
+		}
+	}
+	if v := field("volume"); v != "" {
+		if c.Volume, err = strconv.ParseFloat(v, 64); err != nil {
+			return c, false, err
+		}
+	}
+	return c, true, nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+		if layout == time.RFC3339 {
+			return t, nil
+		}
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, marketLocation), nil
+	}
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("Invalid date: %s", value)
+}
+
+// mergeCandles returns the candles ordered by time, later lists replacing candles of the same time
+func mergeCandles(lists ...[]Candle) []Candle {
+	byTime := map[int64]Candle{}
+	for _, candles := range lists {
+		for _, c := range candles {
+			byTime[c.Timestamp.Unix()] = c
+		}
+	}
+	ret := make([]Candle, 0, len(byTime))
+	for _, c := range byTime {
+		ret = append(ret, c)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Timestamp.Before(ret[j].Timestamp) })
+	return ret
+}
+
+// WriteCandles writes candles in the layout ParseCandles reads back
+func WriteCandles(w io.Writer, candles []Candle) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"Timestamp", "Open", "High", "Low", "Close", "Volume"})
+	for _, c := range candles {
+		writer.Write([]string{
+			c.Timestamp.Format(time.RFC3339),
+			strconv.FormatFloat(c.Open, 'f', -1, 64),
+			strconv.FormatFloat(c.High, 'f', -1, 64),
+			strconv.FormatFloat(c.Low, 'f', -1, 64),
+			strconv.FormatFloat(c.Close, 'f', -1, 64),
+			strconv.FormatFloat(c.Volume, 'f', -1, 64),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// runImport implements the import subcommand: robotrader import <symbol> <file>...
+func runImport(storageDir string, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("Usage: robotrader import <symbol> <file>...")
+	}
+	symbol := strings.ToUpper(args[0])
+
+	// The server would overwrite the files, it imports through POST /api/import while running
+	storage := NewStorage()
+	if err := storage.Open(storageDir + "/tickers.json"); errors.Is(err, errStorageLocked) {
+		return fmt.Errorf("%v, import through POST /api/import instead", err)
+	} else if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	if !storage.HasTicker(symbol) {
+		if err := storage.AddTicker(symbol, 0); err != nil {
+			return err
+		}
+	}
+	for _, filename := range args[1:] {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		candles, err := ParseCandles(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+		if err := storage.ImportCandles(symbol, candles...); err != nil {
+			return err
+		}
+		fmt.Printf("Imported %d candles for %s from %s\n", len(candles), symbol, filename)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func day(date string) time.Time {
+	t, _ := time.ParseInLocation(time.DateOnly, date, marketLocation)
+	return t
+}
+
+func TestParseCandles(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want []Candle
+		err  bool
+	}{
+		{
+			name: "yahoo",
+			csv:  "Date,Open,High,Low,Close,Adj Close,Volume\n2024-01-02,1,2,0.5,1.5,1.4,100\n2024-01-03,null,null,null,null,null,null\n",
+			want: []Candle{{Timestamp: day("2024-01-02"), Open: 1, High: 2, Low: 0.5, Close: 1.5, Volume: 100}},
+		},
+		{
+			name: "stooq",
+			csv:  "<TICKER>,<PER>,<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>\nAAPL.US,D,20240102,000000,1,2,0.5,1.5,100\n",
+			want: []Candle{{Timestamp: day("2024-01-02"), Open: 1, High: 2, Low: 0.5, Close: 1.5, Volume: 100}},
+		},
+		{
+			name: "no volume",
+			csv:  "date,open,high,low,close\n01/02/2024,1,2,0.5,1.5\n",
+			want: []Candle{{Timestamp: day("2024-01-02"), Open: 1, High: 2, Low: 0.5, Close: 1.5}},
+		},
+		{name: "missing column", csv: "Date,Open,High,Low\n2024-01-02,1,2,0.5\n", err: true},
+		{name: "invalid date", csv: "Date,Open,High,Low,Close\nyesterday,1,2,0.5,1.5\n", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candles, err := ParseCandles(strings.NewReader(tt.csv))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("Expected error, got %+v", candles)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(candles) != len(tt.want) {
+				t.Fatalf("Got %+v, want %+v", candles, tt.want)
+			}
+			for i := range candles {
+				if !candles[i].Timestamp.Equal(tt.want[i].Timestamp) || candles[i].Close != tt.want[i].Close || candles[i].Volume != tt.want[i].Volume {
+					t.Errorf("Got %+v, want %+v", candles[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMergeCandles(t *testing.T) {
+	history := []Candle{{Timestamp: day("2024-01-03"), Close: 3}, {Timestamp: day("2024-01-04"), Close: 4}}
+	// Overlapping and older candles, the imported ones replace the history of the same day
+	imported := []Candle{{Timestamp: day("2024-01-04"), Close: 40}, {Timestamp: day("2024-01-01"), Close: 1}, {Timestamp: day("2024-01-02"), Close: 2}}
+	fetched := []Candle{{Timestamp: day("2024-01-05"), Close: 5}}
+	got := mergeCandles(history, imported, fetched)
+	want := []float64{1, 2, 3, 40, 5}
+	if len(got) != len(want) {
+		t.Fatalf("Got %+v", got)
+	}
+	for i := range got {
+		if got[i].Close != want[i] {
+			t.Errorf("Got %+v, want closes %v", got, want)
+			break
+		}
+	}
+	if got := mergeCandles(); len(got) != 0 {
+		t.Errorf("Got %+v", got)
+	}
+}
+
+func TestImportCandles(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStorage()
+	if err := s.Open(filepath.Join(dir, "tickers.json")); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.AddTicker("AAPL", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ImportCandles("MSFT", Candle{Timestamp: day("2024-01-02")}); err == nil {
+		t.Error("Imported unknown symbol")
+	}
+
+	// Concurrent imports of disjoint years all end up in the history file
+	wg := sync.WaitGroup{}
+	for year := 2000; year < 2010; year++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			candles := []Candle{}
+			for d := day(fmt.Sprintf("%d-01-01", year)); d.Year() == year; d = d.AddDate(0, 0, 1) {
+				candles = append(candles, Candle{Timestamp: d, Open: 1, High: 2, Low: 0.5, Close: 1.5, Volume: float64(year)})
+			}
+			if err := s.ImportCandles("AAPL", candles...); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	f, err := os.Open(filepath.Join(dir, "history", "AAPL.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	history, err := ParseCandles(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	days := int(day("2010-01-01").Sub(day("2000-01-01")).Hours()/24 + 0.5)
+	if len(history) != days {
+		t.Errorf("Got %d candles in history, want %d", len(history), days)
+	}
+	// Imported history is kept beyond keepCandles, also after new candles and a restart
+	s.InsertCandles("AAPL", Candle{Timestamp: day("2024-01-02"), Open: 1, High: 2, Low: 0.5, Close: 1.5})
+	if n := len(s.GetAllClose("AAPL")); n != days+1 {
+		t.Errorf("Got %d candles in memory, want %d", n, days+1)
+	}
+	s.Close()
+	s = NewStorage()
+	if err := s.Open(filepath.Join(dir, "tickers.json")); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if n := len(s.GetAllClose("AAPL")); n < days {
+		t.Errorf("Got %d candles in memory after restart, want at least %d", n, days)
+	}
+}
+
+func TestKeepCandles(t *testing.T) {
+	s := fallingStorage(t, keepCandles+100)
+	if n := len(s.GetAllClose("AAPL")); n != keepCandles {
+		t.Errorf("Got %d candles, want %d", n, keepCandles)
+	}
+}
+
+func TestRunImportLocked(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStorage()
+	if err := s.Open(filepath.Join(dir, "tickers.json")); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "AAPL.csv")
+	if err := os.WriteFile(file, []byte("Date,Open,High,Low,Close\n2024-01-02,1,2,0.5,1.5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runImport(dir, []string{"aapl", file}); err == nil || !strings.Contains(err.Error(), "POST /api/import") {
+		t.Errorf("Got error %v while the storage is open", err)
+	}
+	s.Close()
+	if err := runImport(dir, []string{"aapl", file}); err != nil {
+		t.Error(err)
+	}
+}
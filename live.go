@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	LIVE_QUEUE     = 64 // events per client
+	LIVE_KEEPALIVE = 30 * time.Second
+)
+
+type LiveEventType string
+
+const (
+	LiveCandle LiveEventType = "candle"
+	LiveSignal LiveEventType = "signal"
+	LiveNews   LiveEventType = "news"
+	LiveRemove LiveEventType = "remove"
+)
+
+// LiveCandleEvent is a new or updated candle with its indicators and the ticker's row
+type LiveCandleEvent struct {
+	Symbol string   `json:"symbol"`
+	Candle CandleV1 `json:"candle"`
+	Ticker TickerV1 `json:"ticker"`
+}
+
+type LiveSignalEvent struct {
+	Symbol    string    `json:"symbol"`
+	Signal    string    `json:"signal"`
+	Price     float64   `json:"price"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type LiveRemoveEvent struct {
+	Symbol string `json:"symbol"`
+}
+
+// publishCandle sends the latest candle of the symbol, e.g. after it changed or its buy price did
+func publishCandle(live *Live, storage *Storage, symbol string) {
+	point, ok := storage.GetChartPoint(symbol)
+	if !ok {
+		return
+	}
+	row, _ := storage.GetTickerRow(symbol)
+	live.Publish(LiveCandle, []string{symbol}, LiveCandleEvent{Symbol: symbol, Candle: newCandleV1(point), Ticker: newTickerV1(row)})
+}
+
+type liveClient struct {
+	symbol string // empty for every symbol
+	events chan []byte
+}
+
+// Live pushes candles, signals and news to web clients with Server-Sent Events
+type Live struct {
+	mu      sync.Mutex
+	clients map[*liveClient]struct{}
+	done    chan struct{}
+}
+
+func NewLive() *Live {
+	return &Live{
+		clients: map[*liveClient]struct{}{},
+		done:    make(chan struct{}),
+	}
+}
+
+// Publish sends the event to the clients following any of the symbols. Slow clients miss
+// events instead of holding up the main loop.
+func (l *Live) Publish(evt LiveEventType, symbols []string, data any) {
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	msg := []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", evt, buf))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for c := range l.clients {
+		if c.symbol != "" && !slices.Contains(symbols, c.symbol) {
+			continue
+		}
+		select {
+		case c.events <- msg:
+		default:
+		}
+	}
+}
+
+// Close ends every stream, so the web server can shut down
+func (l *Live) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-l.done:
+	default:
+		close(l.done)
+	}
+}
+
+// Handler streams events, optionally only those of the symbol query parameter
+func (l *Live) Handler(c echo.Context) error {
+	client := &liveClient{
+		symbol: strings.ToUpper(c.QueryParam("symbol")),
+		events: make(chan []byte, LIVE_QUEUE),
+	}
+	l.mu.Lock()
+	l.clients[client] = struct{}{}
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		delete(l.clients, client)
+		l.mu.Unlock()
+	}()
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.Header().Set(echo.HeaderConnection, "keep-alive")
+	// Disable proxy buffering, e.g. nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+
+	keepalive := time.NewTicker(LIVE_KEEPALIVE)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-l.done:
+			return nil
+		case <-keepalive.C:
+			if _, err := w.Write([]byte(": keepalive\n\n")); err != nil {
+				return nil
+			}
+		case msg := <-client.events:
+			if _, err := w.Write(msg); err != nil {
+				return nil
+			}
+		}
+		w.Flush()
+	}
+}
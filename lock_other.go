@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// lockFile only opens the file, storage isn't locked without flock
+func lockFile(filename string) (*os.File, error) {
+	return os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+}
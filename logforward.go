@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	LOG_BATCH_WINDOW = 5 * time.Second
+	LOG_BATCH_LINES  = 50
+	LOG_RATE         = 10 * time.Second
+	LOG_BURST        = 3
+	LOG_QUEUE        = 20 // batches
+	LOG_RETRIES      = 5
+	LOG_BACKOFF      = 2 * time.Second
+)
+
+type LogLevel int
+
+const (
+	LogInfo LogLevel = iota
+	LogWarn
+	LogError
+	LogOff
+)
+
+func ParseLogLevel(name string) (LogLevel, error) {
+	switch strings.ToLower(name) {
+	case "", "info":
+		return LogInfo, nil
+	case "warn", "warning":
+		return LogWarn, nil
+	case "error":
+		return LogError, nil
+	case "off", "none":
+		return LogOff, nil
+	}
+	return LogInfo, fmt.Errorf("Unknown log level: %s", name)
+}
+
+// logLevel guesses the severity of a log line, as the standard logger has no levels
+func logLevel(line string) LogLevel {
+	lower := strings.ToLower(line)
+	switch {
+	case strings.HasPrefix(lower, "failed"), strings.Contains(lower, "error"), strings.Contains(lower, "panic"):
+		return LogError
+	case strings.HasPrefix(lower, "denied"), strings.HasPrefix(lower, "no "), strings.Contains(lower, "warn"):
+		return LogWarn
+	}
+	return LogInfo
+}
+
+// LogForwarder forwards log lines to chat, batched within a window and rate limited,
+// retrying batches the chat backend rejects
+type LogForwarder struct {
+	level    LogLevel
+	lines    chan string
+	backends []*logBackend
+}
+
+// logBackend queues batches for one chat backend, so a failing backend is retried on its own
+// and the others do not get duplicates
+type logBackend struct {
+	bot     Notifier
+	batches chan string
+	limiter *rate.Limiter
+}
+
+func NewLogForwarder(level LogLevel, bots ...Notifier) *LogForwarder {
+	f := &LogForwarder{
+		level: level,
+		lines: make(chan string, LOG_BATCH_LINES*LOG_QUEUE),
+	}
+	for _, bot := range bots {
+		f.backends = append(f.backends, &logBackend{
+			bot:     bot,
+			batches: make(chan string, LOG_QUEUE),
+			limiter: rate.NewLimiter(rate.Every(LOG_RATE), LOG_BURST),
+		})
+	}
+	return f
+}
+
+// Write never blocks the logger, lines are dropped when the queue is full
+func (f *LogForwarder) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if line == "" || logLevel(line) < f.level {
+			continue
+		}
+		select {
+		case f.lines <- line:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+func (f *LogForwarder) Run(ctx context.Context) {
+	for _, b := range f.backends {
+		go b.send(ctx)
+	}
+
+	batch := []string{}
+	dropped := 0
+	var window <-chan time.Time
+	flush := func() {
+		if dropped > 0 {
+			batch = append(batch, fmt.Sprintf("... %d more lines", dropped))
+		}
+		msg := strings.Join(batch, "\n")
+		for _, b := range f.backends {
+			select {
+			case b.batches <- msg:
+			default:
+				// Keep stdout as the complete log when chat is behind
+			}
+		}
+		batch = []string{}
+		dropped = 0
+		window = nil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case line := <-f.lines:
+			if len(batch) >= LOG_BATCH_LINES {
+				dropped++
+				continue
+			}
+			batch = append(batch, line)
+			if window == nil {
+				window = time.After(LOG_BATCH_WINDOW)
+			}
+		case <-window:
+			flush()
+		}
+	}
+}
+
+func (b *logBackend) send(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case batch := <-b.batches:
+			if err := b.limiter.Wait(ctx); err != nil {
+				return
+			}
+			for n := 0; ; n++ {
+				err := b.bot.SendCode(batch)
+				if err == nil {
+					break
+				}
+				// Not through log, that would forward the failure again
+				if n == LOG_RETRIES {
+					fmt.Fprintf(os.Stderr, "Failed to forward log: %v\n", err)
+					break
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(LOG_BACKOFF << n):
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DIGEST_HOUR   = 16
+	DIGEST_MINUTE = 15
+	DIGEST_MOVERS = 5
+	MAIL_QUEUE    = 100
+)
+
+const signalTemplate = `<p><b>{{.Signal}} {{.Symbol}}</b> at ${{printf "%.2f" .Close}}{{if gt .BuyPrice 0.0}} ({{printf "%+.2f" .Change}}% from ${{printf "%.2f" .BuyPrice}}){{end}}</p>
+`
+
+const digestTemplate = `<h2>Daily digest {{.Date}}</h2>
+<h3>Tickers</h3>
+<table>
+<tr><th>Symbol</th><th>Buy Price</th><th>Close</th><th>Change</th><th>Signal</th></tr>
+{{range .Tickers}}<tr><td>{{.Symbol}}</td><td>{{if gt .BuyPrice 0.0}}${{printf "%.2f" .BuyPrice}}{{end}}</td><td>${{printf "%.2f" .Close}}</td><td>{{if gt .BuyPrice 0.0}}{{printf "%+.2f" .Change}}%{{end}}</td><td>{{.Signal}}</td></tr>
+{{end}}</table>
+<h3>Top movers</h3>
+<table>
+{{range .Movers}}<tr><td>{{.Symbol}}</td><td>${{printf "%.2f" .Close}}</td><td>{{printf "%+.2f" .Change}}%</td></tr>
+{{end}}</table>
+<h3>New signals</h3>
+{{if .Signals}}<ul>
+{{range .Signals}}<li>{{.Time.Format "15:04"}} {{.Signal}} {{.Symbol}} ${{printf "%.2f" .Close}}</li>
+{{end}}</ul>{{else}}<p>None</p>{{end}}
+`
+
+type MailerConfig struct {
+	Host        string
+	Port        string
+	Username    string
+	Password    string
+	From        string
+	To          []string
+	TemplateDir string
+}
+
+type Mover struct {
+	Symbol string
+	Close  float64
+	Change float64
+}
+
+type SignalRecord struct {
+	Time time.Time
+	TickerTable
+}
+
+type DigestData struct {
+	Date    string
+	Tickers []TickerTable
+	Movers  []Mover
+	Signals []SignalRecord
+}
+
+type mailMessage struct {
+	subject string
+	body    []byte
+}
+
+// Mailer sends signal alerts and the end-of-day digest over SMTP
+type Mailer struct {
+	config    MailerConfig
+	storage   *Storage
+	templates *template.Template
+	signals   []SignalRecord
+	queue     chan mailMessage
+	mu        sync.Mutex
+}
+
+func NewMailer(config MailerConfig, storage *Storage) (*Mailer, error) {
+	templates := template.New("")
+	for name, text := range map[string]string{"signal.html": signalTemplate, "digest.html": digestTemplate} {
+		// Templates in the template directory override the built-in ones
+		if config.TemplateDir != "" {
+			if b, err := os.ReadFile(filepath.Join(config.TemplateDir, name)); err == nil {
+				text = string(b)
+			} else if !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+		if _, err := templates.New(name).Parse(text); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return &Mailer{
+		config:    config,
+		storage:   storage,
+		templates: templates,
+		queue:     make(chan mailMessage, MAIL_QUEUE),
+	}, nil
+}
+
+func (m *Mailer) enabled() bool {
+	return m.config.Host != "" && len(m.config.To) > 0
+}
+
+// Run sends the queued signal alerts and the digest, so slow SMTP servers do not hold up the main loop
+func (m *Mailer) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg := <-m.queue:
+			if err := m.send(msg.subject, msg.body); err != nil {
+				log.Printf("Failed to send signal email: %v", err)
+			}
+		case <-time.After(time.Until(nextDigest(time.Now()))):
+			if err := m.SendDigest(); err != nil {
+				log.Printf("Failed to send digest: %v", err)
+			}
+		}
+	}
+}
+
+// nextDigest returns the next weekday digest time in New York
+func nextDigest(now time.Time) time.Time {
+	now = now.In(marketLocation)
+	t := time.Date(now.Year(), now.Month(), now.Day(), DIGEST_HOUR, DIGEST_MINUTE, 0, 0, marketLocation)
+	for !t.After(now) || t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// SendSignal records the signal for the digest and queues its alert
+func (m *Mailer) SendSignal(row TickerTable) error {
+	m.mu.Lock()
+	m.signals = append(m.signals, SignalRecord{Time: time.Now().In(marketLocation), TickerTable: row})
+	m.mu.Unlock()
+	if !m.enabled() {
+		return nil
+	}
+	body := &bytes.Buffer{}
+	if err := m.templates.ExecuteTemplate(body, "signal.html", row); err != nil {
+		return err
+	}
+	select {
+	case m.queue <- mailMessage{subject: fmt.Sprintf("%s %s", row.Signal, row.Symbol), body: body.Bytes()}:
+		return nil
+	default:
+		return fmt.Errorf("Mail queue full")
+	}
+}
+
+func (m *Mailer) SendDigest() error {
+	m.mu.Lock()
+	signals := m.signals
+	m.signals = nil
+	m.mu.Unlock()
+	if !m.enabled() {
+		return nil
+	}
+
+	data := DigestData{
+		Date:    time.Now().In(marketLocation).Format(time.DateOnly),
+		Tickers: m.storage.GetTickerTable(),
+		Signals: signals,
+	}
+	sort.Slice(data.Tickers, func(i, j int) bool { return data.Tickers[i].Symbol < data.Tickers[j].Symbol })
+	for _, t := range data.Tickers {
+		if change := m.storage.GetDayChange(t.Symbol); !math.IsNaN(change) {
+			data.Movers = append(data.Movers, Mover{Symbol: t.Symbol, Close: t.Close, Change: change})
+		}
+	}
+	sort.Slice(data.Movers, func(i, j int) bool { return math.Abs(data.Movers[i].Change) > math.Abs(data.Movers[j].Change) })
+	if len(data.Movers) > DIGEST_MOVERS {
+		data.Movers = data.Movers[:DIGEST_MOVERS]
+	}
+
+	body := &bytes.Buffer{}
+	if err := m.templates.ExecuteTemplate(body, "digest.html", data); err != nil {
+		return err
+	}
+	return m.send("Daily digest "+data.Date, body.Bytes())
+}
+
+func (m *Mailer) send(subject string, body []byte) error {
+	msg := &bytes.Buffer{}
+	fmt.Fprintf(msg, "From: %s\r\n", m.config.From)
+	fmt.Fprintf(msg, "To: %s\r\n", strings.Join(m.config.To, ", "))
+	fmt.Fprintf(msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(msg, "Content-Type: text/html; charset=utf-8\r\n\r\n")
+	msg.Write(body)
+
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+	}
+	return smtp.SendMail(net.JoinHostPort(m.config.Host, m.config.Port), auth, m.config.From, m.config.To, msg.Bytes())
+}
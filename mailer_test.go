@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+type smtpMail struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpServer is a stand-in SMTP server passing received mails to the channel, greeting after the delay
+func smtpServer(t *testing.T, delay time.Duration) (string, <-chan smtpMail) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	mails := make(chan smtpMail, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				time.Sleep(delay)
+				c := textproto.NewConn(conn)
+				c.PrintfLine("220 localhost ESMTP")
+				mail := smtpMail{}
+				for {
+					line, err := c.ReadLine()
+					if err != nil {
+						return
+					}
+					cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+					switch cmd {
+					case "EHLO", "HELO":
+						c.PrintfLine("250 localhost")
+					case "MAIL":
+						mail.from = line
+						c.PrintfLine("250 OK")
+					case "RCPT":
+						mail.to = append(mail.to, line)
+						c.PrintfLine("250 OK")
+					case "DATA":
+						c.PrintfLine("354 Go ahead")
+						buf, err := c.ReadDotBytes()
+						if err != nil {
+							return
+						}
+						mail.data = string(buf)
+						mails <- mail
+						c.PrintfLine("250 OK")
+					case "QUIT":
+						c.PrintfLine("221 Bye")
+						return
+					default:
+						c.PrintfLine("502 Not implemented")
+					}
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), mails
+}
+
+func testMailer(t *testing.T, addr string) *Mailer {
+	host, port, _ := net.SplitHostPort(addr)
+	m, err := NewMailer(MailerConfig{
+		Host: host,
+		Port: port,
+		From: "bot@example.com",
+		To:   []string{"a@example.com", "b@example.com"},
+	}, NewStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMailerSendSignal(t *testing.T) {
+	addr, mails := smtpServer(t, 0)
+	m := testMailer(t, addr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+
+	if err := m.SendSignal(TickerTable{Symbol: "AAPL", BuyPrice: 100, Close: 110, Change: 10, Signal: SignalSell}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case mail := <-mails:
+		if mail.from != "MAIL FROM:<bot@example.com>" {
+			t.Errorf("Got %q", mail.from)
+		}
+		if len(mail.to) != 2 || mail.to[0] != "RCPT TO:<a@example.com>" || mail.to[1] != "RCPT TO:<b@example.com>" {
+			t.Errorf("Got recipients %q", mail.to)
+		}
+		header, body, _ := strings.Cut(mail.data, "\n\n")
+		r := textproto.NewReader(bufio.NewReader(strings.NewReader(header + "\n\n")))
+		h, err := r.ReadMIMEHeader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Get("Subject") != "sell AAPL" || h.Get("To") != "a@example.com, b@example.com" || !strings.HasPrefix(h.Get("Content-Type"), "text/html") {
+			t.Errorf("Got header %v", h)
+		}
+		if want := "<p><b>sell AAPL</b> at $110.00 (&#43;10.00% from $100.00)</p>\n"; body != want {
+			t.Errorf("Got body %q, want %q", body, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No mail received")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.signals) != 1 || m.signals[0].Symbol != "AAPL" {
+		t.Errorf("Got signals %+v", m.signals)
+	}
+}
+
+func TestMailerSendSignalAsync(t *testing.T) {
+	// A slow server must not hold up the caller
+	addr, mails := smtpServer(t, 300*time.Millisecond)
+	m := testMailer(t, addr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+
+	start := time.Now()
+	for _, symbol := range []string{"AAPL", "MSFT"} {
+		if err := m.SendSignal(TickerTable{Symbol: symbol, Close: 100, Signal: SignalBuy}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("SendSignal took %v", d)
+	}
+	for _, want := range []string{"Subject: buy AAPL", "Subject: buy MSFT"} {
+		select {
+		case mail := <-mails:
+			if !strings.Contains(mail.data, want) {
+				t.Errorf("Got mail %q, want %s", mail.data, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("No mail received")
+		}
+	}
+}
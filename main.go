@@ -2,42 +2,38 @@ package main
 
 import (
 	"context"
+	"errors"
+	"expvar"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
-	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/labstack/echo/v4"
+	"golang.org/x/time/rate"
 )
 
 const (
-	DAYS = 730
+	DAYS               = 730
+	SUMMARY_DAYS       = 5
+	NEWS_ALERT_BURST   = 3
+	NEWS_ALERT_EVERY   = 5 * time.Minute
+	NEWS_COMMAND_LIMIT = 5
+	MUTE_DURATION      = 24 * time.Hour
+	DASHBOARD_INTERVAL = time.Minute // Dashboards are edited at most this often
 )
 
 func main() {
 	log.SetFlags(0)
-	alpacaApiKey := os.Getenv("ALPACA_API_KEY")
-	alpacaApiSecret := os.Getenv("ALPACA_API_SECRET")
-	if alpacaApiKey == "" || alpacaApiSecret == "" {
-		log.Fatal("ALPACA_API_KEY or ALPACA_API_SECRET is not set")
-	}
-
-	matrixHomeserver := os.Getenv("MATRIX_HOMESERVER")
-	matrixUserId := os.Getenv("MATRIX_USER_ID")
-	matrixAccessToken := os.Getenv("MATRIX_ACCESS_TOKEN")
-	matrixRoomId := os.Getenv("MATRIX_ROOM_ID")
-	if matrixHomeserver == "" || matrixUserId == "" || matrixAccessToken == "" || matrixRoomId == "" {
-		log.Fatal("MATRIX_HOMESERVER, MATRIX_USER_ID, MATRIX_ACCESS_TOKEN or MATRIX_ROOM_ID is not set")
-	}
 
 	storageDir := os.Getenv("STORAGE_DIR")
 	if storageDir == "" {
@@ -45,6 +41,32 @@ func main() {
 	} else {
 		storageDir = strings.TrimRight(storageDir, "/")
 	}
+	if keep := os.Getenv("KEEP_CANDLES"); keep != "" {
+		n, err := strconv.Atoi(keep)
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid KEEP_CANDLES: %s", keep)
+		}
+		keepCandles = n
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(storageDir, os.Args[2:]); err != nil {
+			log.Fatalf("Failed to import: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "hash-password" {
+		if err := runHashPassword(os.Stdin, os.Stdout); err != nil {
+			log.Fatalf("Failed to hash password: %v", err)
+		}
+		return
+	}
+
+	alpacaApiKey := os.Getenv("ALPACA_API_KEY")
+	alpacaApiSecret := os.Getenv("ALPACA_API_SECRET")
+	if alpacaApiKey == "" || alpacaApiSecret == "" {
+		log.Fatal("ALPACA_API_KEY or ALPACA_API_SECRET is not set")
+	}
 
 	storage := NewStorage()
 	if err := storage.Open(storageDir + "/tickers.json"); err != nil {
@@ -52,53 +74,47 @@ func main() {
 	}
 	defer storage.Close()
 
-	fetcher := NewFetcher(alpacaApiKey, alpacaApiSecret)
-	bot := NewBot(matrixHomeserver, matrixUserId, matrixAccessToken, matrixRoomId)
-	if bot == nil {
-		log.Fatal("Failed to create bot")
+	fetcher := NewFetcher(alpacaApiKey, alpacaApiSecret, os.Getenv("ALPACA_DATA_URL"))
+	permissions, err := NewPermissions(os.Getenv("ROLES"), os.Getenv("ROOM_ROLE"), storageDir+"/audit.jsonl")
+	if err != nil {
+		log.Fatalf("Failed to parse roles: %v", err)
+	}
+	notifiers, closers := newNotifiers(storageDir, permissions)
+	for _, c := range closers {
+		defer c.Close()
 	}
-	log.SetOutput(io.MultiWriter(os.Stdout, bot))
+	bot := NewNotifiers(notifiers...)
+	logLevel, err := ParseLogLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	logForwarder := NewLogForwarder(logLevel, notifiers...)
+	log.SetOutput(io.MultiWriter(os.Stdout, logForwarder))
 
 	log.Print("Starting...")
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	go logForwarder.Run(ctx)
 
 	if err := fetcher.Connect(ctx); err != nil {
 		log.Fatalf("Failed to connect to fetcher: %v", err)
 	}
 
-	// Worker pool for fetching history candles
-	jobs := make(chan string)
-	wg := sync.WaitGroup{}
-	for workers := 0; workers < 10; workers++ {
-		wg.Add(1)
-		go func(symbols <-chan string) {
-			defer wg.Done()
-			for symbol := range symbols {
-				candles, err := fetcher.Fetch(symbol, time.Now().AddDate(0, 0, -DAYS), time.Now())
-				if err != nil {
-					log.Printf("Failed to fetch candles for %s: %v", symbol, err)
-				} else if len(candles) == 0 {
-					log.Printf("No candles fetched for %s", symbol)
-				} else {
-					storage.InsertCandles(symbol, candles...)
-					if err := fetcher.Sub(symbol); err != nil {
-						log.Printf("Failed to subscribe to %s: %v", symbol, err)
-					}
-				}
-			}
-		}(jobs)
-	}
 	log.Print("Fetching history candles...")
-	// Send jobs
 	symbols := storage.GetSymbols()
+	failed := fetchHistory(ctx, fetcher, storage, symbols)
 	for _, symbol := range symbols {
-		jobs <- symbol
+		if slices.Contains(failed, symbol) {
+			continue
+		}
+		if err := fetcher.Sub(symbol); err != nil {
+			log.Printf("Failed to subscribe to %s: %v", symbol, err)
+		}
+	}
+	if len(failed) > 0 {
+		bot.SendText(fmt.Sprintf("Failed to fetch history for %d symbols: %s", len(failed), strings.Join(failed, ", ")))
 	}
-	close(jobs)
-	// Wait for workers
-	wg.Wait()
 
 	go func() {
 		if err := fetcher.Run(ctx); err != nil && err != context.Canceled {
@@ -106,6 +122,34 @@ func main() {
 		}
 	}()
 
+	smtpPort := os.Getenv("SMTP_PORT")
+	if smtpPort == "" {
+		smtpPort = "587"
+	}
+	mailer, err := NewMailer(MailerConfig{
+		Host:        os.Getenv("SMTP_HOST"),
+		Port:        smtpPort,
+		Username:    os.Getenv("SMTP_USERNAME"),
+		Password:    os.Getenv("SMTP_PASSWORD"),
+		From:        os.Getenv("SMTP_FROM"),
+		To:          splitList(os.Getenv("EMAIL_TO")),
+		TemplateDir: os.Getenv("EMAIL_TEMPLATE_DIR"),
+	}, storage)
+	if err != nil {
+		log.Fatalf("Failed to create mailer: %v", err)
+	}
+	go mailer.Run(ctx)
+
+	calendar := NewCalendar(alpacaApiKey, alpacaApiSecret, os.Getenv("ALPACA_TRADING_URL"))
+	scheduler, err := NewScheduler(os.Getenv("JOBS"), calendar.IsTradingDay)
+	if err != nil {
+		log.Fatalf("Failed to create scheduler: %v", err)
+	}
+	go scheduler.Run(ctx)
+
+	webhooks := NewWebhooks(splitList(os.Getenv("WEBHOOK_URLS")), os.Getenv("WEBHOOK_SECRET"), storageDir+"/webhooks.dead.jsonl")
+	go webhooks.Run(ctx)
+
 	go func() {
 		if err := bot.Run(ctx); err != nil && err != context.Canceled {
 			log.Fatalf("Failed to run bot: %v", err)
@@ -118,20 +162,104 @@ func main() {
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
 
+	chartOnSignal := os.Getenv("CHART_ON_SIGNAL") == "true"
+	webURL = os.Getenv("WEB_URL")
+	quietHours, err := ParseQuietHours(os.Getenv("QUIET_HOURS"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	newsLimiter := rate.NewLimiter(rate.Every(NEWS_ALERT_EVERY), NEWS_ALERT_BURST)
+
 	// Web server
+	auth, err := NewAuth(os.Getenv("API_TOKENS"), os.Getenv("WEB_USERS"), os.Getenv("WEB_SESSION_SECRET"))
+	if err != nil {
+		log.Fatalf("Failed to configure authentication: %v", err)
+	}
+	if !auth.Enabled() {
+		log.Print("No API_TOKENS or WEB_USERS, the API is open")
+	}
+	live := NewLive()
 	e := echo.New()
+	e.HTTPErrorHandler = httpErrorHandler(e)
+	// X-Forwarded-For is trusted from proxies on private networks only, so clients can't dodge the login rate limit
+	e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	e.Use(auth.Middleware)
 	e.GET("/health", func(c echo.Context) error {
 		return c.String(200, "OK")
 	})
+	e.POST("/auth/login", auth.Login)
+	e.POST("/auth/logout", auth.Logout)
+	e.GET("/api/me", func(c echo.Context) error {
+		user, _ := c.Get("user").(string)
+		return c.JSON(200, map[string]any{"user": user, "auth": auth.Enabled()})
+	})
 	e.GET("/api/tickers/", func(c echo.Context) error {
-		tickers := storage.GetTickerTable()
+		tickers := storage.GetRoomTickerTable(DEFAULT_ROOM)
 		return c.JSON(200, tickers)
 	})
-	e.GET("/api/tickers/:symbol", func(c echo.Context) error {
+	e.GET("/api/tickers/:symbol", chartHandler(legacyAPI, storage))
+	registerWatchlistAPI(e.Group("/api"), legacyAPI, ctx, storage, fetcher, live, webhooks)
+	registerAPIV1(e, ctx, storage, fetcher, live, webhooks)
+	e.GET("/api/tickers/:symbol/news", func(c echo.Context) error {
+		symbol := c.Param("symbol")
+		news := storage.GetNews(symbol)
+		return c.JSON(200, news)
+	})
+	e.GET("/api/tickers/:symbol/export", func(c echo.Context) error {
 		symbol := c.Param("symbol")
-		chartData := storage.GetChartData(symbol)
-		return c.JSON(200, chartData)
+		format := c.QueryParam("format")
+		if format == "" {
+			format = "csv"
+		}
+		rows := storage.GetExportRows(symbol)
+		if rows == nil {
+			return c.String(http.StatusNotFound, "Unknown symbol")
+		}
+		buf, contentType, err := Export(rows, format)
+		if err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", symbol+"."+format))
+		return c.Blob(200, contentType, buf)
+	})
+	e.POST("/api/import", func(c echo.Context) error {
+		symbol := strings.ToUpper(c.FormValue("symbol"))
+		if !storage.HasTicker(symbol) {
+			return c.String(http.StatusNotFound, "Unknown symbol")
+		}
+		fh, err := c.FormFile("file")
+		if err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		defer f.Close()
+		candles, err := ParseCandles(f)
+		if err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		if err := storage.ImportCandles(symbol, candles...); err != nil {
+			return c.String(http.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(200, map[string]int{"imported": len(candles)})
+	})
+	// Live candles, signals and news for the web UI
+	e.GET("/api/events", live.Handler)
+	e.GET("/api/jobs", func(c echo.Context) error {
+		return c.JSON(200, scheduler.Jobs())
 	})
+	e.GET("/api/quote/:symbol", func(c echo.Context) error {
+		symbol := strings.ToUpper(c.Param("symbol"))
+		quote, err := fetcher.Quote(c.Request().Context(), symbol)
+		if err != nil {
+			return c.String(http.StatusBadGateway, err.Error())
+		}
+		return c.JSON(200, quote)
+	})
+	// Outbound message metrics
+	e.GET("/debug/vars", echo.WrapHandler(expvar.Handler()))
 	e.Static("/", "dist")
 	e.HideBanner = true
 
@@ -142,95 +270,302 @@ func main() {
 		e.Close()
 	}()
 
+	commands := NewCommands()
+	commands.Authorize = permissions.Authorize
+	registerCommands(commands, ctx, cancel, storage, fetcher, scheduler, live, webhooks)
+
+	// Replies and alerts go to the room, or to every backend for unknown rooms
+	room := func(room string) Notifier {
+		if r, ok := bot.Room(room); ok {
+			return r
+		}
+		return bot
+	}
+
+	// Commands from chat and scheduled jobs
+	messages := make(chan Message, 100)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg := <-bot.Message():
+				messages <- msg
+			case msg := <-scheduler.Commands():
+				messages <- Message{Sender: SCHEDULER, Body: msg}
+			}
+		}
+	}()
+
+	quietTicker := time.NewTicker(time.Minute)
+	defer quietTicker.Stop()
+	// Rooms whose dashboard changed since the last edit
+	dashboardTicker := time.NewTicker(DASHBOARD_INTERVAL)
+	defer dashboardTicker.Stop()
+	dashboards := map[string]bool{}
+
 	// Main loop
 	for {
 		select {
+		case now := <-quietTicker.C:
+			for r, msgs := range quietHours.Release(now) {
+				room(r).SendText(fmt.Sprintf("Signals during quiet hours:\n%s", strings.Join(msgs, "\n")))
+			}
+		case <-dashboardTicker.C:
+			for r, dashboardId := range storage.GetDashboards() {
+				if !dashboards[r] {
+					continue
+				}
+				if _, err := room(r).SendDashboard(dashboardId, watchlistTable(storage, r)); err != nil {
+					log.Printf("Failed to update dashboard: %v", err)
+				}
+			}
+			clear(dashboards)
 		case <-shutdown:
 			cancel()
 		case <-ctx.Done():
+			live.Close()
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
 			if err := e.Shutdown(ctx); err != nil {
 				log.Printf("Failed to shutdown web server: %v", err)
 			}
 			return
-		case msg := <-bot.Message():
-			s := strings.Split(msg, " ")
-			switch s[0] {
-			case "help": // Help
-				bot.SendText("Commands: add <symbol> [buy price], rm <symbol>, ls, mem, stop")
-			case "stop": // Stop the bot
-				cancel()
-			case "add": // Add ticker
-				if len(s) < 2 {
-					continue
+		case msg := <-messages:
+			reply := room(msg.Room).Thread(msg.Thread)
+			if err := commands.Dispatch(msg, reply); err != nil {
+				var permErr *PermissionError
+				if errors.As(err, &permErr) {
+					log.Printf("Denied %s to %s", permErr.Command, msg.Sender)
+				}
+				reply.SendText(err.Error())
+			}
+		case n := <-fetcher.News():
+			// Store under every watched symbol, alert once per article
+			symbols := []string{}
+			for _, symbol := range n.Symbols {
+				if len(storage.InsertNews(symbol, n)) > 0 {
+					symbols = append(symbols, symbol)
+				}
+			}
+			if len(symbols) == 0 {
+				continue
+			}
+			live.Publish(LiveNews, symbols, newNewsV1(n))
+			if !newsLimiter.Allow() {
+				continue
+			}
+			// One alert per room with the symbols it watches. News alerts are not
+			// summarized after quiet hours, the news command lists them.
+			rooms := map[string][]string{}
+			for _, symbol := range symbols {
+				if quietHours.Active(time.Now()) {
+					break
+				}
+				for _, r := range storage.GetWatchers(symbol) {
+					if !storage.IsMuted(r, symbol) {
+						rooms[r] = append(rooms[r], symbol)
+					}
 				}
-				symbol := strings.ToUpper(s[1])
-				buyPrice := 0.0
-				if len(s) > 2 {
-					buyPrice, _ = strconv.ParseFloat(s[2], 64)
+			}
+			for r, symbols := range rooms {
+				room(r).SendText(fmt.Sprintf("news %s: %s %s", strings.Join(symbols, ", "), n.Headline, n.URL))
+			}
+			for _, symbol := range symbols {
+				if row, ok := storage.GetTickerRow(symbol); ok {
+					webhooks.Send(WebhookEvent{Event: WebhookNews, Timestamp: n.CreatedAt, TickerTable: row, News: &n})
+				}
+			}
+		case d := <-fetcher.Stream():
+			signal := storage.InsertCandles(d.Symbol, d.Candle)
+			publishCandle(live, storage, d.Symbol)
+			for r := range storage.GetDashboards() {
+				if storage.IsWatched(r, d.Symbol) {
+					dashboards[r] = true
 				}
-				candles, _ := fetcher.Fetch(symbol, time.Now().AddDate(0, 0, -DAYS), time.Now())
-				if len(candles) == 0 {
-					log.Printf("Failed to fetch candles for %s", symbol)
+			}
+			if signal == SignalHold {
+				continue
+			}
+			live.Publish(LiveSignal, []string{d.Symbol}, LiveSignalEvent{Symbol: d.Symbol, Signal: signalV1(signal), Price: d.Candle.Close, Timestamp: d.Candle.Timestamp})
+			// Every watching room gets the signal with the change from its own buy price
+			for _, r := range storage.GetWatchers(d.Symbol) {
+				if storage.IsMuted(r, d.Symbol) {
 					continue
 				}
-				storage.AddTicker(symbol, buyPrice)
-				storage.InsertCandles(symbol, candles...)
-				fetcher.Sub(symbol)
-			case "rm": // Remove ticker
-				if len(s) < 2 {
+				buyPrice := storage.GetRoomBuyPrice(r, d.Symbol)
+				msg := ""
+				if signal == SignalSell && buyPrice > 0 {
+					msg = fmt.Sprintf("%s %s %+.02f", signal, d.Symbol, storage.GetRoomChange(r, d.Symbol))
+				} else if signal == SignalBuy {
+					msg = fmt.Sprintf("%s %s", signal, d.Symbol)
+					if buyPrice > 0 {
+						msg += fmt.Sprintf(" %+.02f%%", storage.GetRoomChange(r, d.Symbol))
+					}
+				}
+				if msg == "" {
 					continue
 				}
-				symbol := strings.ToUpper(s[1])
-				fetcher.Unsub(symbol)
-				storage.DelTicker(symbol)
-			case "ind": // Print indicators
-				if len(s) < 2 {
+				if quietHours.Active(time.Now()) {
+					quietHours.Hold(r, msg)
 					continue
 				}
-				symbol := strings.ToUpper(s[1])
-				close := storage.GetClose(symbol)
-				bbl, bbm, bbh := storage.GetBB(symbol)
-				stochK, stochD := storage.GetStoch(symbol)
-				mfi := storage.GetMFI(symbol)
-				adx := storage.GetADX(symbol)
-				bot.SendText(fmt.Sprintf("%s: Close $%.02f, BB(%.02f, %0.2f, %.02f), Stoch(%.02f, %0.2f), MFI(%.02f), ADX(%0.2f)", symbol, close, bbl, bbm, bbh, stochK, stochD, mfi, adx))
-			case "ls": // List tickers
-				w := table.NewWriter()
-				w.Style().Options.DrawBorder = false
-				w.AppendHeader(table.Row{"Symbol", "Buy Price", "Close", "Change", "Signal"})
-				for _, symbol := range storage.GetSymbols() {
-					var buyPriceStr, closeStr, changeStr, signalStr string
-					if buyPrice := storage.GetBuyPrice(symbol); buyPrice > 0 {
-						buyPriceStr = fmt.Sprintf("$%.02f", buyPrice)
-						changeStr = fmt.Sprintf("%+.02f%%", storage.GetChange(symbol))
+				room(r).SendSignal(signal, d.Symbol, d.Candle.Close, msg)
+				if chartOnSignal {
+					if err := sendChart(room(r), storage, d.Symbol, CHART_DAYS); err != nil {
+						log.Print(err)
 					}
-					closeStr = fmt.Sprintf("$%.2f", storage.GetClose(symbol))
-					signalStr = string(storage.GetSignal(symbol))
-					w.AppendRow([]interface{}{symbol, buyPriceStr, closeStr, changeStr, signalStr})
-				}
-				bot.SendCode(w.Render())
-			case "mem": // Print memory stats
-				var m runtime.MemStats
-				runtime.ReadMemStats(&m)
-				msg := fmt.Sprintf("Alloc = %v MiB\nTotalAlloc = %v MiB\nSys = %v MiB\nNumGC = %v", m.Alloc/1024/1024, m.TotalAlloc/1024/1024, m.Sys/1024/1024, m.NumGC)
-				bot.SendCode(msg)
-			default: // Unknown command
-				bot.SendText("Unknown command")
+				}
 			}
-		case d := <-fetcher.Stream():
-			signal := storage.InsertCandles(d.Symbol, d.Candle)
-			if signal == SignalSell && storage.GetBuyPrice(d.Symbol) > 0 {
-				msg := fmt.Sprintf("%s %s %+.02f", signal, d.Symbol, storage.GetChange(d.Symbol))
-				bot.SendText(msg)
-			} else if signal == SignalBuy {
-				msg := fmt.Sprintf("%s %s", signal, d.Symbol)
-				if storage.GetBuyPrice(d.Symbol) > 0 {
-					msg += fmt.Sprintf(" %+.02f%%", storage.GetChange(d.Symbol))
+			// Webhooks get the signal of every room as with chat, sells only of rooms with a buy price
+			mailed := false
+			for _, r := range storage.GetWatchers(d.Symbol) {
+				row, ok := storage.GetRoomTickerRow(r, d.Symbol)
+				if !ok || (signal == SignalSell && !(row.BuyPrice > 0)) {
+					continue
+				}
+				webhooks.Send(WebhookEvent{Event: WebhookSignal, Timestamp: d.Candle.Timestamp, Room: r, TickerTable: row})
+				if mailed {
+					continue
 				}
-				bot.SendText(msg)
+				// Emails go to the same recipients for every room, without a room's buy price
+				row.BuyPrice, row.Change = 0, 0
+				if err := mailer.SendSignal(row); err != nil {
+					log.Printf("Failed to send signal email: %v", err)
+				}
+				mailed = true
 			}
 		}
 	}
 }
+
+func sendChart(bot Notifier, storage *Storage, symbol string, days int) error {
+	buf, err := RenderChart(symbol, storage.GetChartRange(symbol, ChartQuery{Limit: days}), days)
+	if err != nil {
+		return err
+	}
+	if err := bot.SendImage(buf, "image/png", symbol+".png"); err != nil {
+		return fmt.Errorf("Failed to upload chart for %s: %v", symbol, err)
+	}
+	return nil
+}
+
+// fetchHistory fetches history candles and news with a worker pool and returns the symbols that failed
+func fetchHistory(ctx context.Context, fetcher *Fetcher, storage *Storage, symbols []string) []string {
+	jobs := make(chan string)
+	wg := sync.WaitGroup{}
+	mu := sync.Mutex{}
+	failed := []string{}
+	for workers := 0; workers < 10; workers++ {
+		wg.Add(1)
+		go func(symbols <-chan string) {
+			defer wg.Done()
+			for symbol := range symbols {
+				candles, err := fetcher.Fetch(ctx, symbol, time.Now().AddDate(0, 0, -DAYS), time.Now())
+				if err != nil || len(candles) == 0 {
+					if err != nil {
+						log.Printf("Failed to fetch candles for %s: %v", symbol, err)
+					} else {
+						log.Printf("No candles fetched for %s", symbol)
+					}
+					mu.Lock()
+					failed = append(failed, symbol)
+					mu.Unlock()
+					continue
+				}
+				storage.InsertCandles(symbol, candles...)
+				if news, err := fetcher.FetchNews(ctx, symbol, time.Now().AddDate(0, 0, -NEWS_DAYS), time.Now()); err != nil {
+					log.Printf("Failed to fetch news for %s: %v", symbol, err)
+				} else {
+					storage.InsertNews(symbol, news...)
+				}
+			}
+		}(jobs)
+	}
+	// Send jobs
+	for _, symbol := range symbols {
+		jobs <- symbol
+	}
+	close(jobs)
+	// Wait for workers
+	wg.Wait()
+	sort.Strings(failed)
+	return failed
+}
+
+// newNotifiers creates a chat backend for every configured service and returns the stores to close on exit
+func newNotifiers(storageDir string, permissions *Permissions) ([]Notifier, []io.Closer) {
+	notifiers := []Notifier{}
+	closers := []io.Closer{}
+
+	matrixHomeserver := os.Getenv("MATRIX_HOMESERVER")
+	matrixUserId := os.Getenv("MATRIX_USER_ID")
+	matrixAccessToken := os.Getenv("MATRIX_ACCESS_TOKEN")
+	matrixRoomId := os.Getenv("MATRIX_ROOM_ID")
+	if matrixHomeserver != "" {
+		if matrixUserId == "" || matrixAccessToken == "" || matrixRoomId == "" {
+			log.Fatal("MATRIX_USER_ID, MATRIX_ACCESS_TOKEN or MATRIX_ROOM_ID is not set")
+		}
+		bot := NewBot(matrixHomeserver, matrixUserId, matrixAccessToken, matrixRoomId, storageDir+"/outbox.json", permissions.Listed)
+		if bot == nil {
+			log.Fatal("Failed to create Matrix bot")
+		}
+		if os.Getenv("MATRIX_E2EE") == "true" {
+			store, err := bot.EnableCrypto(context.Background(), CryptoConfig{
+				Store:       storageDir + "/crypto.db",
+				PickleKey:   os.Getenv("MATRIX_PICKLE_KEY"),
+				RecoveryKey: os.Getenv("MATRIX_RECOVERY_KEY"),
+				MinTrust:    os.Getenv("MATRIX_E2EE_TRUST"),
+			})
+			if err != nil {
+				log.Fatalf("Failed to enable Matrix E2EE: %v", err)
+			}
+			closers = append(closers, store)
+		}
+		notifiers = append(notifiers, bot)
+	}
+
+	telegramToken := os.Getenv("TELEGRAM_BOT_TOKEN")
+	telegramChatId := os.Getenv("TELEGRAM_CHAT_ID")
+	if telegramToken != "" {
+		bot, err := NewTelegramBot(os.Getenv("TELEGRAM_API_URL"), telegramToken, telegramChatId)
+		if err != nil {
+			log.Fatalf("Failed to create Telegram bot: %v", err)
+		}
+		notifiers = append(notifiers, bot)
+	}
+
+	slackToken := os.Getenv("SLACK_BOT_TOKEN")
+	slackChannelId := os.Getenv("SLACK_CHANNEL_ID")
+	if slackToken != "" {
+		if slackChannelId == "" {
+			log.Fatal("SLACK_CHANNEL_ID is not set")
+		}
+		notifiers = append(notifiers, NewSlackBot(os.Getenv("SLACK_API_URL"), slackToken, slackChannelId))
+	}
+
+	discordToken := os.Getenv("DISCORD_BOT_TOKEN")
+	discordChannelId := os.Getenv("DISCORD_CHANNEL_ID")
+	if discordToken != "" {
+		if discordChannelId == "" {
+			log.Fatal("DISCORD_CHANNEL_ID is not set")
+		}
+		notifiers = append(notifiers, NewDiscordBot(os.Getenv("DISCORD_API_URL"), discordToken, discordChannelId))
+	}
+
+	if len(notifiers) == 0 {
+		log.Fatal("No chat backend configured: set MATRIX_HOMESERVER, TELEGRAM_BOT_TOKEN, SLACK_BOT_TOKEN or DISCORD_BOT_TOKEN")
+	}
+	return notifiers, closers
+}
+
+// splitList parses a comma separated environment variable
+func splitList(value string) []string {
+	ret := []string{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Mute silences alerts of the symbol, or all symbols with ALL_SYMBOLS, in the room until the given time
+func (s *Storage) Mute(room string, symbol string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.mutes[room] == nil {
+		s.mutes[room] = map[string]time.Time{}
+	}
+	s.mutes[room][symbol] = until
+	return s.saveMutes()
+}
+
+func (s *Storage) Unmute(room string, symbol string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.mutes[room], symbol)
+	return s.saveMutes()
+}
+
+func (s *Storage) IsMuted(room string, symbol string) bool {
+	return time.Now().Before(s.GetMutedUntil(room, symbol))
+}
+
+// GetMutedUntil returns the end of the symbol's or the room's mute, whichever is later
+func (s *Storage) GetMutedUntil(room string, symbol string) time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	until := s.mutes[room][symbol]
+	if all := s.mutes[room][ALL_SYMBOLS]; all.After(until) {
+		until = all
+	}
+	if time.Now().After(until) {
+		return time.Time{}
+	}
+	return until
+}
+
+func (s *Storage) saveMutes() error {
+	// Drop expired mutes
+	for room, symbols := range s.mutes {
+		for symbol, until := range symbols {
+			if time.Now().After(until) {
+				delete(symbols, symbol)
+			}
+		}
+		if len(symbols) == 0 {
+			delete(s.mutes, room)
+		}
+	}
+	if s.muteFilename == "" {
+		return nil
+	}
+	buf, err := json.Marshal(s.mutes)
+	if err != nil {
+		return err
+	}
+	return writeFile(s.muteFilename, buf)
+}
+
+func (s *Storage) loadMutes() error {
+	s.mutes = map[string]map[string]time.Time{}
+	buf, err := os.ReadFile(s.muteFilename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, &s.mutes)
+}
+
+// parseDuration parses Go durations and whole days, e.g. 2d
+func parseDuration(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return d, nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// Message is an inbound command with the backend specific IDs of its sender and room.
+// Messages from the configured room of a backend have DEFAULT_ROOM.
+type Message struct {
+	Sender string
+	Room   string
+	Thread string // Replies go to this thread, if the backend supports threads
+	Body   string
+}
+
+// Notifier is a chat backend that delivers messages and receives commands
+type Notifier interface {
+	Run(ctx context.Context) error
+	Message() <-chan Message
+	SendText(msg string) error
+	SendCode(msg string) error
+	// SendHtml sends formatted text, backends without HTML support send the plain text
+	SendHtml(text string, html string) error
+	SendTable(table Table) error
+	// SendSignal sends a signal alert, backends supporting reactions map them back to the signal, symbol and price
+	SendSignal(signal Signal, symbol string, price float64, msg string) error
+	SendImage(buf []byte, contentType string, filename string) error
+	SendFile(buf []byte, contentType string, filename string) error
+	// Room returns a notifier sending to another room, if the backend serves it
+	Room(room string) (Notifier, bool)
+	// Thread returns a notifier replying in a thread, or itself without thread support
+	Thread(thread string) Notifier
+	// SendDashboard edits the dashboard message, or posts a new one without an ID, and returns its ID
+	SendDashboard(dashboardId string, table Table) (string, error)
+}
+
+var errDashboardUnsupported = errors.New("Dashboard is not supported")
+
+// ColumnKind lets backends with rich formatting style the cells of a column
+type ColumnKind int
+
+const (
+	ColumnText ColumnKind = iota
+	ColumnSymbol
+	ColumnChange
+	ColumnSignal
+)
+
+type Table struct {
+	Header []string
+	Kinds  []ColumnKind
+	Rows   [][]string
+}
+
+func (t Table) kind(column int) ColumnKind {
+	if column < len(t.Kinds) {
+		return t.Kinds[column]
+	}
+	return ColumnText
+}
+
+// renderTable renders the table as plain text for monospace output
+func renderTable(t Table) string {
+	w := table.NewWriter()
+	w.Style().Options.DrawBorder = false
+	r := table.Row{}
+	for _, v := range t.Header {
+		r = append(r, v)
+	}
+	w.AppendHeader(r)
+	for _, row := range t.Rows {
+		r := table.Row{}
+		for _, v := range row {
+			r = append(r, v)
+		}
+		w.AppendRow(r)
+	}
+	return w.Render()
+}
+
+// Notifiers fans out messages to every backend and merges their commands
+type Notifiers struct {
+	notifiers []Notifier
+	msg       chan Message
+}
+
+func NewNotifiers(notifiers ...Notifier) *Notifiers {
+	return &Notifiers{
+		notifiers: notifiers,
+		msg:       make(chan Message, 100),
+	}
+}
+
+func (n *Notifiers) Write(p []byte) (int, error) {
+	n.SendText(string(p))
+	return len(p), nil
+}
+
+func (n *Notifiers) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(n.notifiers))
+	wg := sync.WaitGroup{}
+	for _, v := range n.notifiers {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- v.Run(ctx)
+		}()
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case msg := <-v.Message():
+					n.msg <- msg
+				}
+			}
+		}()
+	}
+	err := <-errs
+	cancel()
+	wg.Wait()
+	return err
+}
+
+// Room returns the backend serving the room, or all backends for the default room
+func (n *Notifiers) Room(room string) (Notifier, bool) {
+	if room == DEFAULT_ROOM {
+		return n, true
+	}
+	for _, v := range n.notifiers {
+		if r, ok := v.Room(room); ok {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+func (n *Notifiers) Thread(thread string) Notifier {
+	notifiers := make([]Notifier, len(n.notifiers))
+	for k, v := range n.notifiers {
+		notifiers[k] = v.Thread(thread)
+	}
+	return &Notifiers{notifiers: notifiers, msg: n.msg}
+}
+
+// SendDashboard uses the first backend supporting dashboards
+func (n *Notifiers) SendDashboard(dashboardId string, table Table) (string, error) {
+	errs := []error{}
+	for _, v := range n.notifiers {
+		id, err := v.SendDashboard(dashboardId, table)
+		if err == nil {
+			return id, nil
+		}
+		errs = append(errs, err)
+	}
+	return "", errors.Join(errs...)
+}
+
+func (n *Notifiers) Message() <-chan Message {
+	return n.msg
+}
+
+func (n *Notifiers) SendText(msg string) error {
+	errs := []error{}
+	for _, v := range n.notifiers {
+		errs = append(errs, v.SendText(msg))
+	}
+	return errors.Join(errs...)
+}
+
+func (n *Notifiers) SendCode(msg string) error {
+	errs := []error{}
+	for _, v := range n.notifiers {
+		errs = append(errs, v.SendCode(msg))
+	}
+	return errors.Join(errs...)
+}
+
+func (n *Notifiers) SendHtml(text string, html string) error {
+	errs := []error{}
+	for _, v := range n.notifiers {
+		errs = append(errs, v.SendHtml(text, html))
+	}
+	return errors.Join(errs...)
+}
+
+func (n *Notifiers) SendTable(table Table) error {
+	errs := []error{}
+	for _, v := range n.notifiers {
+		errs = append(errs, v.SendTable(table))
+	}
+	return errors.Join(errs...)
+}
+
+func (n *Notifiers) SendSignal(signal Signal, symbol string, price float64, msg string) error {
+	errs := []error{}
+	for _, v := range n.notifiers {
+		errs = append(errs, v.SendSignal(signal, symbol, price, msg))
+	}
+	return errors.Join(errs...)
+}
+
+func (n *Notifiers) SendImage(buf []byte, contentType string, filename string) error {
+	errs := []error{}
+	for _, v := range n.notifiers {
+		errs = append(errs, v.SendImage(buf, contentType, filename))
+	}
+	return errors.Join(errs...)
+}
+
+func (n *Notifiers) SendFile(buf []byte, contentType string, filename string) error {
+	errs := []error{}
+	for _, v := range n.notifiers {
+		errs = append(errs, v.SendFile(buf, contentType, filename))
+	}
+	return errors.Join(errs...)
+}
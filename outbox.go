@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+const (
+	OUTBOX_RETRIES     = 8
+	OUTBOX_BACKOFF     = time.Second
+	OUTBOX_MAX_BACKOFF = 5 * time.Minute
+	OUTBOX_TIMEOUT     = 30 * time.Second
+)
+
+// Outbound metrics, served with the other expvars on /debug/vars
+var (
+	outboxQueued    = expvar.NewInt("matrix_queued")
+	outboxDelivered = expvar.NewInt("matrix_delivered")
+	outboxRetried   = expvar.NewInt("matrix_retried")
+	outboxFailed    = expvar.NewInt("matrix_failed")
+)
+
+type outboxItem struct {
+	Seq      int64
+	TxnID    string // Sent on every attempt, so the homeserver ignores repeats of delivered events
+	RoomID   id.RoomID
+	Type     string
+	Content  json.RawMessage
+	Attempts int
+	Signal   *signalEvent `json:",omitempty"`
+}
+
+type outboxResult struct {
+	eventId id.EventID
+	err     error
+}
+
+// Outbox delivers Matrix events in order, retrying transient failures. Pending events
+// are persisted, so they survive restarts.
+type Outbox struct {
+	client   *mautrix.Client
+	filename string
+	mu       sync.Mutex
+	items    []*outboxItem
+	seq      int64
+	waiters  map[int64]chan outboxResult
+	wake     chan struct{}
+	// sent is called after an event is delivered
+	sent func(item *outboxItem, eventId id.EventID)
+}
+
+func NewOutbox(client *mautrix.Client, filename string) (*Outbox, error) {
+	o := &Outbox{
+		client:   client,
+		filename: filename,
+		items:    []*outboxItem{},
+		waiters:  map[int64]chan outboxResult{},
+		wake:     make(chan struct{}, 1),
+	}
+	if filename == "" {
+		return o, nil
+	}
+	buf, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return o, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(buf) > 0 {
+		if err := json.Unmarshal(buf, &o.items); err != nil {
+			return nil, err
+		}
+	}
+	for _, item := range o.items {
+		o.seq = max(o.seq, item.Seq)
+		if item.TxnID == "" {
+			item.TxnID = client.TxnID()
+		}
+	}
+	outboxQueued.Add(int64(len(o.items)))
+	return o, nil
+}
+
+// Enqueue persists the event and returns a channel receiving its delivery result
+func (o *Outbox) Enqueue(roomId id.RoomID, evtType event.Type, content any, signal *signalEvent) (<-chan outboxResult, error) {
+	buf, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.seq++
+	item := &outboxItem{
+		Seq:     o.seq,
+		TxnID:   o.client.TxnID(),
+		RoomID:  roomId,
+		Type:    evtType.Type,
+		Content: buf,
+		Signal:  signal,
+	}
+	o.items = append(o.items, item)
+	if err := o.save(); err != nil {
+		o.items = o.items[:len(o.items)-1]
+		return nil, err
+	}
+	outboxQueued.Add(1)
+	result := make(chan outboxResult, 1)
+	o.waiters[item.Seq] = result
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return result, nil
+}
+
+func (o *Outbox) Run(ctx context.Context) {
+	for {
+		o.mu.Lock()
+		var item *outboxItem
+		if len(o.items) > 0 {
+			item = o.items[0]
+		}
+		o.mu.Unlock()
+		if item == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-o.wake:
+			}
+			continue
+		}
+
+		eventId, err := o.deliver(ctx, item)
+		if err == nil {
+			outboxDelivered.Add(1)
+			o.done(item, outboxResult{eventId: eventId})
+			if o.sent != nil {
+				o.sent(item, eventId)
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		// The head blocks later events until it is delivered or given up, to keep the order
+		wait, ok := retryAfter(err, item.Attempts)
+		if !ok || item.Attempts >= OUTBOX_RETRIES {
+			outboxFailed.Add(1)
+			// Not through log, the forwarder would queue it again
+			fmt.Fprintf(os.Stderr, "Failed to send %s to %s: %v\n", item.Type, item.RoomID, err)
+			o.done(item, outboxResult{err: err})
+			continue
+		}
+		outboxRetried.Add(1)
+		o.mu.Lock()
+		item.Attempts++
+		o.save()
+		o.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (o *Outbox) deliver(ctx context.Context, item *outboxItem) (id.EventID, error) {
+	ctx, cancel := context.WithTimeout(ctx, OUTBOX_TIMEOUT)
+	defer cancel()
+	resp, err := o.client.SendMessageEvent(ctx, item.RoomID, event.Type{Type: item.Type, Class: event.MessageEventType}, item.Content, mautrix.ReqSendEvent{TransactionID: item.TxnID})
+	if err != nil {
+		return "", err
+	}
+	return resp.EventID, nil
+}
+
+// done removes the head of the queue and reports the result to the sender
+func (o *Outbox) done(item *outboxItem, result outboxResult) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.items = o.items[1:]
+	o.save()
+	outboxQueued.Add(-1)
+	if waiter, ok := o.waiters[item.Seq]; ok {
+		waiter <- result
+		delete(o.waiters, item.Seq)
+	}
+}
+
+func (o *Outbox) save() error {
+	if o.filename == "" {
+		return nil
+	}
+	buf, err := json.Marshal(o.items)
+	if err != nil {
+		return err
+	}
+	return writeFile(o.filename, buf)
+}
+
+// retryAfter returns how long to wait before retrying, honoring the homeserver's
+// rate limit, or false if the error is permanent
+func retryAfter(err error, attempts int) (time.Duration, bool) {
+	backoff := min(OUTBOX_BACKOFF<<attempts, OUTBOX_MAX_BACKOFF)
+	var httpErr mautrix.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Response == nil {
+		// Network errors and timeouts
+		return backoff, true
+	}
+	status := httpErr.Response.StatusCode
+	if status == http.StatusTooManyRequests {
+		if httpErr.RespError != nil {
+			if ms, ok := httpErr.RespError.ExtraData["retry_after_ms"].(float64); ok {
+				return time.Duration(ms) * time.Millisecond, true
+			}
+		}
+		if seconds, err := strconv.Atoi(httpErr.Response.Header.Get("Retry-After")); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+		return backoff, true
+	}
+	return backoff, status >= http.StatusInternalServerError
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Role int
+
+const (
+	RoleViewer Role = iota
+	RoleTrader
+	RoleAdmin
+)
+
+// SCHEDULER is the sender of scheduled jobs, which run as admin
+const SCHEDULER = "scheduler"
+
+var roleNames = map[Role]string{
+	RoleViewer: "viewer",
+	RoleTrader: "trader",
+	RoleAdmin:  "admin",
+}
+
+func (r Role) String() string {
+	return roleNames[r]
+}
+
+func ParseRole(name string) (Role, error) {
+	for k, v := range roleNames {
+		if v == strings.ToLower(strings.TrimSpace(name)) {
+			return k, nil
+		}
+	}
+	return RoleViewer, fmt.Errorf("Unknown role: %s", name)
+}
+
+type PermissionError struct {
+	Command string
+	Role    Role
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("%s: permission denied, requires %s", e.Command, e.Role)
+}
+
+// Permissions maps senders to roles and records restricted commands in an audit trail
+type Permissions struct {
+	roles       map[string]Role
+	defaultRole Role
+	roomRole    Role
+	audit       string
+	mu          sync.Mutex
+}
+
+// NewPermissions parses roles as comma separated sender=role pairs,
+// e.g. "@alice:example.org=admin,@bob:example.org=trader". Without any
+// roles configured everyone in the configured rooms is admin. Senders not
+// listed get roomRole in other rooms, by default trader without any roles
+// configured, so they can keep their room's watchlist, and viewer otherwise.
+func NewPermissions(roles string, roomRole string, audit string) (*Permissions, error) {
+	p := &Permissions{
+		roles:       map[string]Role{},
+		defaultRole: RoleViewer,
+		roomRole:    RoleViewer,
+		audit:       audit,
+	}
+	for _, entry := range splitList(roles) {
+		sender, name, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("Invalid role mapping: %s", entry)
+		}
+		role, err := ParseRole(name)
+		if err != nil {
+			return nil, err
+		}
+		p.roles[strings.TrimSpace(sender)] = role
+	}
+	if len(p.roles) == 0 {
+		p.defaultRole = RoleAdmin
+		p.roomRole = RoleTrader
+	}
+	if roomRole != "" {
+		role, err := ParseRole(roomRole)
+		if err != nil {
+			return nil, err
+		}
+		p.roomRole = role
+	}
+	return p, nil
+}
+
+// RoleOf returns the sender's role, senders not listed get the default role only in the
+// configured room and the room role elsewhere, as anyone may message the bot there
+func (p *Permissions) RoleOf(sender string, room string) Role {
+	if sender == SCHEDULER {
+		return RoleAdmin
+	}
+	if role, ok := p.roles[sender]; ok {
+		return role
+	}
+	if room != DEFAULT_ROOM {
+		return p.roomRole
+	}
+	return p.defaultRole
+}
+
+// Listed reports whether the sender has a role in ROLES
+func (p *Permissions) Listed(sender string) bool {
+	_, ok := p.roles[sender]
+	return ok
+}
+
+// Authorize checks the sender's role against the command and audits restricted commands
+func (p *Permissions) Authorize(msg Message, cmd *Command) error {
+	role := p.RoleOf(msg.Sender, msg.Room)
+	if role < cmd.Role {
+		p.record(msg, role, cmd.Name, false)
+		return &PermissionError{Command: cmd.Name, Role: cmd.Role}
+	}
+	if cmd.Role > RoleViewer {
+		p.record(msg, role, cmd.Name, true)
+	}
+	return nil
+}
+
+// record appends an entry to the audit trail as a JSON line
+func (p *Permissions) record(msg Message, role Role, command string, allowed bool) {
+	if p.audit == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, err := os.OpenFile(p.audit, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	json.NewEncoder(f).Encode(struct {
+		Time    time.Time
+		Sender  string
+		Room    string `json:",omitempty"`
+		Role    string
+		Command string
+		Allowed bool
+	}{
+		Time:    time.Now(),
+		Sender:  msg.Sender,
+		Room:    msg.Room,
+		Role:    role.String(),
+		Command: command,
+		Allowed: allowed,
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestPermissionsRoleOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		roles    string
+		roomRole string
+		sender   string
+		room     string
+		want     Role
+	}{
+		{name: "no roles, configured room", sender: "@eve:example.org", room: DEFAULT_ROOM, want: RoleAdmin},
+		{name: "no roles, other room", sender: "@eve:example.org", room: "!dm:example.org", want: RoleTrader},
+		{name: "no roles, room role", roomRole: "viewer", sender: "@eve:example.org", room: "!dm:example.org", want: RoleViewer},
+		{name: "listed, other room", roles: "@alice:example.org=admin", sender: "@alice:example.org", room: "!dm:example.org", want: RoleAdmin},
+		{name: "unlisted, configured room", roles: "@alice:example.org=admin", sender: "@eve:example.org", room: DEFAULT_ROOM, want: RoleViewer},
+		{name: "unlisted, other room", roles: "@alice:example.org=admin", sender: "@eve:example.org", room: "!dm:example.org", want: RoleViewer},
+		{name: "unlisted, room role", roles: "@alice:example.org=admin", roomRole: "trader", sender: "@eve:example.org", room: "!dm:example.org", want: RoleTrader},
+		{name: "scheduler", roles: "@alice:example.org=admin", sender: SCHEDULER, room: DEFAULT_ROOM, want: RoleAdmin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewPermissions(tt.roles, tt.roomRole, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.RoleOf(tt.sender, tt.room); got != tt.want {
+				t.Errorf("Got %s, want %s", got, tt.want)
+			}
+		})
+	}
+	if _, err := NewPermissions("", "owner", ""); err == nil {
+		t.Error("Got no error for unknown room role")
+	}
+}
+
+func TestPermissionsAuthorizeOtherRoom(t *testing.T) {
+	// Without ROLES anyone may keep their own room's watchlist, but not run admin commands
+	p, err := NewPermissions("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := Message{Sender: "@eve:example.org", Room: "!dm:example.org", Body: "add AAPL"}
+	if err := p.Authorize(msg, &Command{Name: "add", Role: RoleTrader}); err != nil {
+		t.Error(err)
+	}
+	if err := p.Authorize(msg, &Command{Name: "stop", Role: RoleAdmin}); err == nil {
+		t.Error("Got no error for admin command")
+	}
+}
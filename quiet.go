@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QuietHours holds back signals during a daily window in New York time and
+// releases them as one summary per room afterwards
+type QuietHours struct {
+	start   time.Duration // since midnight
+	end     time.Duration
+	mu      sync.Mutex
+	pending map[string][]string
+}
+
+// ParseQuietHours parses a window like 22:00-07:00, an empty value disables quiet hours
+func ParseQuietHours(value string) (*QuietHours, error) {
+	q := &QuietHours{pending: map[string][]string{}}
+	if value == "" {
+		return q, nil
+	}
+	from, to, ok := strings.Cut(value, "-")
+	if !ok {
+		return nil, fmt.Errorf("Invalid quiet hours: %s", value)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid quiet hours: %s", value)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid quiet hours: %s", value)
+	}
+	q.start = time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute
+	q.end = time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute
+	return q, nil
+}
+
+// Active reports whether t is within quiet hours, the window may span midnight
+func (q *QuietHours) Active(t time.Time) bool {
+	if q.start == q.end {
+		return false
+	}
+	t = t.In(marketLocation)
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if q.start < q.end {
+		return now >= q.start && now < q.end
+	}
+	return now >= q.start || now < q.end
+}
+
+// Hold queues the message for the room's summary
+func (q *QuietHours) Hold(room string, msg string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending[room] = append(q.pending[room], msg)
+}
+
+// Release returns the held messages by room once quiet hours are over
+func (q *QuietHours) Release(t time.Time) map[string][]string {
+	if q.Active(t) {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return nil
+	}
+	ret := q.pending
+	q.pending = map[string][]string{}
+	return ret
+}
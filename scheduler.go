@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+type Job struct {
+	Spec        string
+	Command     string
+	TradingDays bool // Skipped on days the market is closed
+	LastRun     time.Time
+	NextRun     time.Time
+	Runs        int
+}
+
+type scheduledJob struct {
+	Job
+	id cron.EntryID
+}
+
+// Scheduler runs bot commands on cron schedules in New York time
+type Scheduler struct {
+	cron       *cron.Cron
+	jobs       []*scheduledJob
+	commands   chan string
+	tradingDay func(t time.Time) (bool, error)
+	mu         sync.Mutex
+}
+
+// NewScheduler parses jobs separated by semicolons, each a cron expression followed by a command,
+// e.g. "5 16 * * 1-5 ls; 0 17 * * 5 summary; 0 2 * * * refetch". Jobs prefixed with "trading"
+// only run on trading days, e.g. "trading 5 16 * * * ls", as told by tradingDay.
+func NewScheduler(jobs string, tradingDay func(t time.Time) (bool, error)) (*Scheduler, error) {
+	s := &Scheduler{
+		cron:       cron.New(cron.WithLocation(marketLocation)),
+		commands:   make(chan string, 100),
+		tradingDay: tradingDay,
+	}
+	for _, entry := range strings.Split(jobs, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		tradingDays := fields[0] == "trading"
+		if tradingDays {
+			fields = fields[1:]
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("Missing schedule: %s", strings.TrimSpace(entry))
+			}
+		}
+		// Descriptors like @daily take one field, expressions take five
+		n := 5
+		if strings.HasPrefix(fields[0], "@") {
+			n = 1
+			if fields[0] == "@every" {
+				n = 2
+			}
+		}
+		if len(fields) <= n {
+			return nil, fmt.Errorf("Missing command: %s", strings.TrimSpace(entry))
+		}
+		job := &scheduledJob{
+			Job: Job{
+				Spec:        strings.Join(fields[:n], " "),
+				Command:     strings.Join(fields[n:], " "),
+				TradingDays: tradingDays,
+			},
+		}
+		id, err := s.cron.AddFunc(job.Spec, func() { s.run(job, time.Now()) })
+		if err != nil {
+			return nil, fmt.Errorf("Invalid schedule %q: %v", job.Spec, err)
+		}
+		job.id = id
+		s.jobs = append(s.jobs, job)
+	}
+	return s, nil
+}
+
+func (s *Scheduler) run(job *scheduledJob, now time.Time) {
+	if job.TradingDays && s.tradingDay != nil {
+		// Without the calendar weekdays are trading days
+		open, err := s.tradingDay(now)
+		if err != nil {
+			log.Printf("Failed to get market calendar: %v", err)
+			weekday := now.In(marketLocation).Weekday()
+			open = weekday != time.Saturday && weekday != time.Sunday
+		}
+		if !open {
+			return
+		}
+	}
+	s.mu.Lock()
+	job.LastRun = now
+	job.Runs++
+	s.mu.Unlock()
+	s.commands <- job.Command
+}
+
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.cron.Start()
+	<-ctx.Done()
+	<-s.cron.Stop().Done()
+	return ctx.Err()
+}
+
+func (s *Scheduler) Commands() <-chan string {
+	return s.commands
+}
+
+func (s *Scheduler) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make([]Job, len(s.jobs))
+	for k, v := range s.jobs {
+		ret[k] = v.Job
+		ret[k].NextRun = s.cron.Entry(v.id).Next
+	}
+	return ret
+}
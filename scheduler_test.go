@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewScheduler(t *testing.T) {
+	tests := []struct {
+		name string
+		jobs string
+		want []Job
+		err  bool
+	}{
+		{name: "empty", jobs: "", want: []Job{}},
+		{
+			name: "expressions and descriptors",
+			jobs: "5 16 * * 1-5 ls; @daily summary 7;@every 1h refetch",
+			want: []Job{{Spec: "5 16 * * 1-5", Command: "ls"}, {Spec: "@daily", Command: "summary 7"}, {Spec: "@every 1h", Command: "refetch"}},
+		},
+		{name: "trading days", jobs: "trading 5 16 * * * ls", want: []Job{{Spec: "5 16 * * *", Command: "ls", TradingDays: true}}},
+		{name: "missing command", jobs: "5 16 * * 1-5", err: true},
+		{name: "missing schedule", jobs: "trading", err: true},
+		{name: "invalid schedule", jobs: "61 16 * * * ls", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewScheduler(tt.jobs, nil)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("Expected error, got %+v", s.Jobs())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			jobs := s.Jobs()
+			if len(jobs) != len(tt.want) {
+				t.Fatalf("Got jobs %+v, want %+v", jobs, tt.want)
+			}
+			for i, job := range jobs {
+				if job.Spec != tt.want[i].Spec || job.Command != tt.want[i].Command || job.TradingDays != tt.want[i].TradingDays {
+					t.Errorf("Got job %+v, want %+v", job, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSchedulerTradingDays(t *testing.T) {
+	monday := time.Date(2024, 7, 1, 16, 5, 0, 0, marketLocation)
+	tests := []struct {
+		name    string
+		jobs    string
+		open    bool
+		err     error
+		now     time.Time
+		command bool
+	}{
+		{name: "open", jobs: "trading @daily ls", open: true, now: monday, command: true},
+		{name: "holiday", jobs: "trading @daily ls", open: false, now: monday, command: false},
+		{name: "every day", jobs: "@daily ls", open: false, now: monday, command: true},
+		{name: "no calendar on a weekday", jobs: "trading @daily ls", err: errors.New("unavailable"), now: monday, command: true},
+		{name: "no calendar on a weekend", jobs: "trading @daily ls", err: errors.New("unavailable"), now: monday.AddDate(0, 0, -1), command: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewScheduler(tt.jobs, func(time.Time) (bool, error) { return tt.open, tt.err })
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.run(s.jobs[0], tt.now)
+			select {
+			case cmd := <-s.Commands():
+				if !tt.command {
+					t.Errorf("Got command %q", cmd)
+				}
+			default:
+				if tt.command {
+					t.Error("No command")
+				}
+			}
+			if runs := s.Jobs()[0].Runs; (runs == 1) != tt.command {
+				t.Errorf("Got %d runs", runs)
+			}
+		})
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/v2/calendar" || r.URL.Query().Get("start") != "2024-01-01" || r.URL.Query().Get("end") != "2024-12-31" {
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"date": "2024-07-03", "open": "09:30", "close": "13:00"}, {"date": "2024-07-05", "open": "09:30", "close": "16:00"}]`))
+	}))
+	defer srv.Close()
+
+	c := NewCalendar("key", "secret", srv.URL)
+	for day, want := range map[string]bool{"2024-07-03": true, "2024-07-04": false, "2024-07-05": true, "2024-07-06": false} {
+		d, _ := time.ParseInLocation(time.DateOnly, day, marketLocation)
+		// Late evening UTC is still the day in New York
+		open, err := c.IsTradingDay(d.Add(20 * time.Hour).UTC())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if open != want {
+			t.Errorf("%s open = %v, want %v", day, open, want)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Got %d calendar requests, want 1", calls)
+	}
+}
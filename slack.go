@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SLACK_API_URL       = "https://slack.com/api"
+	SLACK_POLL_INTERVAL = 5 * time.Second
+)
+
+type SlackBot struct {
+	apiURL    string
+	token     string
+	channelId string
+	client    *http.Client
+	msg       chan Message
+	interval  time.Duration
+	latest    string
+}
+
+type slackMessage struct {
+	Ts    string `json:"ts"`
+	Text  string `json:"text"`
+	User  string `json:"user"`
+	BotId string `json:"bot_id"`
+}
+
+func NewSlackBot(apiURL string, token string, channelId string) *SlackBot {
+	if apiURL == "" {
+		apiURL = SLACK_API_URL
+	}
+	return &SlackBot{
+		apiURL:    strings.TrimRight(apiURL, "/"),
+		token:     token,
+		channelId: channelId,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		msg:       make(chan Message, 100),
+		interval:  SLACK_POLL_INTERVAL,
+		latest:    strconv.FormatInt(time.Now().Unix(), 10) + ".000000",
+	}
+}
+
+func (b *SlackBot) do(req *http.Request, result any) error {
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	r := struct {
+		Ok    bool   `json:"ok"`
+		Error string `json:"error"`
+	}{}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if !r.Ok {
+		return fmt.Errorf("%s", r.Error)
+	}
+	if result != nil {
+		return json.Unmarshal(body, result)
+	}
+	return nil
+}
+
+func (b *SlackBot) callJSON(ctx context.Context, method string, params any, result any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.apiURL+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	return b.do(req, result)
+}
+
+func (b *SlackBot) callForm(ctx context.Context, method string, params url.Values, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.apiURL+"/"+method, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return b.do(req, result)
+}
+
+func (b *SlackBot) Run(ctx context.Context) error {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		history := struct {
+			Messages []slackMessage `json:"messages"`
+		}{}
+		err := b.callForm(ctx, "conversations.history", url.Values{
+			"channel": {b.channelId},
+			"oldest":  {b.latest},
+		}, &history)
+		if err != nil {
+			continue
+		}
+		// History is returned newest first
+		slices.Reverse(history.Messages)
+		for _, m := range history.Messages {
+			b.latest = m.Ts
+			if m.BotId != "" {
+				continue
+			}
+			b.msg <- Message{Sender: "slack:" + m.User, Body: m.Text}
+		}
+	}
+}
+
+func (b *SlackBot) Message() <-chan Message {
+	return b.msg
+}
+
+// Room is not supported, messages only go to the configured channel
+func (b *SlackBot) Room(room string) (Notifier, bool) {
+	return nil, false
+}
+
+func (b *SlackBot) SendText(msg string) error {
+	return b.callJSON(context.Background(), "chat.postMessage", map[string]any{
+		"channel": b.channelId,
+		"text":    msg,
+	}, nil)
+}
+
+func (b *SlackBot) SendCode(msg string) error {
+	return b.SendText("```\n" + msg + "\n```")
+}
+
+func (b *SlackBot) SendHtml(text string, html string) error {
+	return b.SendText(text)
+}
+
+func (b *SlackBot) SendTable(table Table) error {
+	return b.SendCode(renderTable(table))
+}
+
+func (b *SlackBot) Thread(thread string) Notifier {
+	return b
+}
+
+func (b *SlackBot) SendDashboard(dashboardId string, table Table) (string, error) {
+	return "", errDashboardUnsupported
+}
+
+func (b *SlackBot) SendSignal(signal Signal, symbol string, price float64, msg string) error {
+	return b.SendText(msg)
+}
+
+func (b *SlackBot) SendImage(buf []byte, contentType string, filename string) error {
+	return b.SendFile(buf, contentType, filename)
+}
+
+func (b *SlackBot) SendFile(buf []byte, contentType string, filename string) error {
+	ctx := context.Background()
+	upload := struct {
+		UploadURL string `json:"upload_url"`
+		FileId    string `json:"file_id"`
+	}{}
+	err := b.callForm(ctx, "files.getUploadURLExternal", url.Values{
+		"filename": {filename},
+		"length":   {strconv.Itoa(len(buf))},
+	}, &upload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, upload.UploadURL, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Upload failed: HTTP %d", resp.StatusCode)
+	}
+	return b.callJSON(ctx, "files.completeUploadExternal", map[string]any{
+		"files":      []map[string]string{{"id": upload.FileId, "title": filename}},
+		"channel_id": b.channelId,
+	}, nil)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSlackSend(t *testing.T) {
+	calls := []string{}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+		if r.URL.Path != "/upload" && r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		switch r.URL.Path {
+		case "/chat.postMessage":
+			req := map[string]string{}
+			json.NewDecoder(r.Body).Decode(&req)
+			if req["channel"] != "C1" || req["text"] != "```\nhello\n```" {
+				t.Errorf("Got message %v", req)
+			}
+			w.Write([]byte(`{"ok": true}`))
+		case "/files.getUploadURLExternal":
+			if r.FormValue("filename") != "chart.png" || r.FormValue("length") != "3" {
+				t.Errorf("Got upload request %v", r.Form)
+			}
+			w.Write([]byte(`{"ok": true, "upload_url": "` + srv.URL + `/upload", "file_id": "F1"}`))
+		case "/upload":
+			buf, _ := io.ReadAll(r.Body)
+			if string(buf) != "png" || r.Header.Get("Content-Type") != "image/png" {
+				t.Errorf("Got upload %q of %s", buf, r.Header.Get("Content-Type"))
+			}
+		case "/files.completeUploadExternal":
+			req := struct {
+				Files     []map[string]string `json:"files"`
+				ChannelId string              `json:"channel_id"`
+			}{}
+			json.NewDecoder(r.Body).Decode(&req)
+			if req.ChannelId != "C1" || len(req.Files) != 1 || req.Files[0]["id"] != "F1" {
+				t.Errorf("Got complete request %+v", req)
+			}
+			w.Write([]byte(`{"ok": true}`))
+		default:
+			w.Write([]byte(`{"ok": false, "error": "unknown_method"}`))
+		}
+	}))
+	defer srv.Close()
+
+	b := NewSlackBot(srv.URL, "token", "C1")
+	if err := b.SendCode("hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SendImage([]byte("png"), "image/png", "chart.png"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/chat.postMessage", "/files.getUploadURLExternal", "/upload", "/files.completeUploadExternal"}
+	if len(calls) != len(want) {
+		t.Fatalf("Got calls %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("Got calls %v, want %v", calls, want)
+			break
+		}
+	}
+	b.apiURL += "/missing"
+	if err := b.SendText("hello"); err == nil || err.Error() != "unknown_method" {
+		t.Errorf("Got error %v", err)
+	}
+}
+
+func TestSlackPoll(t *testing.T) {
+	mu := sync.Mutex{}
+	oldest := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/conversations.history" || r.FormValue("channel") != "C1" {
+			t.Errorf("Unexpected request %s %v", r.URL.Path, r.Form)
+		}
+		mu.Lock()
+		oldest = append(oldest, r.FormValue("oldest"))
+		first := len(oldest) == 1
+		mu.Unlock()
+		if !first {
+			w.Write([]byte(`{"ok": true, "messages": []}`))
+			return
+		}
+		// Newest first
+		w.Write([]byte(`{"ok": true, "messages": [
+			{"ts": "1700000003.000000", "text": "quote AAPL", "user": "U2"},
+			{"ts": "1700000002.000000", "text": "buy AAPL", "bot_id": "B1"},
+			{"ts": "1700000001.000000", "text": "add AAPL", "user": "U1"}
+		]}`))
+	}))
+	defer srv.Close()
+
+	b := NewSlackBot(srv.URL, "token", "C1")
+	b.interval = 10 * time.Millisecond
+	start := b.latest
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- b.Run(ctx) }()
+
+	for _, want := range []Message{{Sender: "slack:U1", Body: "add AAPL"}, {Sender: "slack:U2", Body: "quote AAPL"}} {
+		select {
+		case msg := <-b.Message():
+			if msg != want {
+				t.Errorf("Got message %+v, want %+v", msg, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("No message received")
+		}
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		mu.Lock()
+		n := len(oldest)
+		mu.Unlock()
+		if n >= 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run returned %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(oldest) < 2 || oldest[0] != start || oldest[1] != "1700000003.000000" {
+		t.Errorf("Got oldest %v", oldest)
+	}
+}
@@ -1,66 +1,189 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"math"
 	"os"
+	"path/filepath"
+	"slices"
 	"sort"
 	"sync"
 	"time"
 )
 
 type Storage struct {
-	tickers map[string]*Ticker
-	mu      sync.RWMutex
-	f       *os.File
+	tickers           map[string]*Ticker
+	watchlists        map[string]map[string]float64 // room -> symbol -> buy price
+	mutes             map[string]map[string]time.Time
+	dashboards        map[string]string // room -> message ID
+	mu                sync.RWMutex
+	filename          string
+	lock              *os.File
+	historyDir        string
+	historyMu         sync.Mutex // Held while merging history files
+	watchlistFilename string
+	muteFilename      string
+	dashboardFilename string
 }
 
 func NewStorage() *Storage {
 	return &Storage{
-		tickers: map[string]*Ticker{},
+		tickers:    map[string]*Ticker{},
+		watchlists: map[string]map[string]float64{},
+		mutes:      map[string]map[string]time.Time{},
+		dashboards: map[string]string{},
 	}
 }
 
+// errStorageLocked is returned by Open while another process, e.g. the server, has the storage open
+var errStorageLocked = errors.New("Storage is in use by another robotrader process")
+
 func (s *Storage) Open(filename string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	var err error
-	s.f, err = os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+	lock, err := lockFile(filepath.Join(filepath.Dir(filename), "robotrader.lock"))
 	if err != nil {
 		return err
 	}
-	return s.load()
+	s.lock = lock
+	s.filename = filename
+	s.historyDir = filepath.Join(filepath.Dir(filename), "history")
+	if err := os.MkdirAll(s.historyDir, 0755); err != nil {
+		return err
+	}
+	if err := s.load(); err != nil {
+		return err
+	}
+	s.watchlistFilename = filepath.Join(filepath.Dir(filename), "watchlists.json")
+	if err := s.loadWatchlists(); err != nil {
+		return err
+	}
+	s.muteFilename = filepath.Join(filepath.Dir(filename), "mutes.json")
+	if err := s.loadMutes(); err != nil {
+		return err
+	}
+	s.dashboardFilename = filepath.Join(filepath.Dir(filename), "dashboards.json")
+	if err := s.loadDashboards(); err != nil {
+		return err
+	}
+	return s.loadHistory()
 }
 
 func (s *Storage) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if s.f != nil {
-		err := s.f.Close()
-		s.f = nil
-		return err
+	s.filename = ""
+	if s.lock == nil {
+		return nil
 	}
-	return nil
+	err := s.lock.Close()
+	s.lock = nil
+	return err
 }
 
+// AddTicker adds the symbol to the default room's watchlist
 func (s *Storage) AddTicker(symbol string, buyPrice float64) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.tickers[symbol] = NewTicker(symbol, buyPrice)
-	return s.save()
+	_, err := s.Watch(DEFAULT_ROOM, symbol, buyPrice)
+	return err
 }
 
+// DelTicker removes the symbol from every watchlist
 func (s *Storage) DelTicker(symbol string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	delete(s.tickers, symbol)
+	for room, symbols := range s.watchlists {
+		delete(symbols, symbol)
+		if len(symbols) == 0 {
+			delete(s.watchlists, room)
+		}
+	}
+	if s.historyDir != "" {
+		os.Remove(s.historyFilename(symbol))
+	}
+	if err := s.saveWatchlists(); err != nil {
+		return err
+	}
 	return s.save()
 }
 
+func (s *Storage) HasTicker(symbol string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.tickers[symbol]
+	return ok
+}
+
+// ImportCandles merges candles into the ticker and its history file, which keeps the full history
+// across restarts
+func (s *Storage) ImportCandles(symbol string, candles ...Candle) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tickers[symbol]
+	if !ok {
+		return fmt.Errorf("Unknown symbol: %s", symbol)
+	}
+	t.Import(candles...)
+	if s.historyDir == "" {
+		return nil
+	}
+	// Concurrent imports would each write back the history without the other's candles
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+	history := []Candle{}
+	if f, err := os.Open(s.historyFilename(symbol)); err == nil {
+		history, err = ParseCandles(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	if err := WriteCandles(buf, mergeCandles(history, candles, t.Candles())); err != nil {
+		return err
+	}
+	return writeFile(s.historyFilename(symbol), buf.Bytes())
+}
+
+// InsertCandles adds candles, ignoring tickers removed meanwhile, e.g. during a background refetch
 func (s *Storage) InsertCandles(symbol string, candles ...Candle) Signal {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.tickers[symbol].Insert(candles...)
+	t, ok := s.tickers[symbol]
+	if !ok {
+		return SignalHold
+	}
+	return t.Insert(candles...)
+}
+
+func (s *Storage) InsertNews(symbol string, news ...News) []News {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tickers[symbol]
+	if !ok {
+		return nil
+	}
+	return t.InsertNews(news...)
+}
+
+func (s *Storage) GetNews(symbol string) []News {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tickers[symbol]
+	if !ok {
+		return nil
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	ret := make([]News, len(t.news))
+	copy(ret, t.news)
+	return ret
 }
 
 func (s *Storage) GetAllTimestamp(symbol string) []time.Time {
@@ -92,9 +215,31 @@ type ChartData struct {
 	SMA       []float64
 	ADX       []float64
 	BuyPrice  float64
+	// defined is the range of each indicator series with values, they are zero outside it
+	defined map[string]definedRange
+}
+
+type definedRange struct {
+	from, to int
 }
 
 func (s *Storage) GetChartData(symbol string) *ChartData {
+	return s.GetChartRange(symbol, ChartQuery{})
+}
+
+// chartFields are the series names of ChartQuery.Fields, timestamps are always included
+var chartFields = []string{"open", "high", "low", "close", "bbh", "bbm", "bbl", "stochk", "stochd", "mfi", "sma", "adx"}
+
+// ChartQuery selects candles and series of the chart data, zero values select everything
+type ChartQuery struct {
+	From   time.Time
+	To     time.Time
+	Fields []string
+	Limit  int // Last candles of the range
+}
+
+// GetChartRange returns the selected candles, series that are not selected are nil
+func (s *Storage) GetChartRange(symbol string, q ChartQuery) *ChartData {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	t, ok := s.tickers[symbol]
@@ -103,44 +248,184 @@ func (s *Storage) GetChartData(symbol string) *ChartData {
 	}
 	t.mu.RLock()
 	defer t.mu.RUnlock()
+	lo, hi := 0, len(t.timestamp)
+	if !q.From.IsZero() {
+		lo = sort.Search(len(t.timestamp), func(i int) bool { return !t.timestamp[i].Before(q.From) })
+	}
+	if !q.To.IsZero() {
+		hi = sort.Search(len(t.timestamp), func(i int) bool { return t.timestamp[i].After(q.To) })
+	}
+	hi = max(hi, lo)
+	if q.Limit > 0 && hi-lo > q.Limit {
+		lo = hi - q.Limit
+	}
+	series := func(field string, values []float64) []float64 {
+		if len(q.Fields) > 0 && !slices.Contains(q.Fields, field) {
+			return nil
+		}
+		// Indicators are not calculated until there is enough data
+		ret := make([]float64, hi-lo)
+		if lo < len(values) {
+			copy(ret, values[lo:min(hi, len(values))])
+		}
+		return ret
+	}
+	defined := map[string]definedRange{}
+	indicator := func(field string, values []float64) []float64 {
+		defined[field] = definedRange{
+			from: max(indicatorLookback[field]-lo, 0),
+			to:   max(min(len(values), hi)-lo, 0),
+		}
+		return series(field, values)
+	}
 	ret := &ChartData{
-		Timestamp: make([]time.Time, len(t.timestamp)),
-		Open:      make([]float64, len(t.open)),
-		High:      make([]float64, len(t.high)),
-		Low:       make([]float64, len(t.low)),
-		Close:     make([]float64, len(t.close)),
-		BBH:       make([]float64, len(t.bbh)),
-		BBM:       make([]float64, len(t.bbm)),
-		BBL:       make([]float64, len(t.bbl)),
-		StochK:    make([]float64, len(t.stochK)),
-		StochD:    make([]float64, len(t.stochD)),
-		MFI:       make([]float64, len(t.mfi)),
-		SMA:       make([]float64, len(t.sma)),
-		ADX:       make([]float64, len(t.adx)),
+		Timestamp: make([]time.Time, hi-lo),
+		Open:      series("open", t.open),
+		High:      series("high", t.high),
+		Low:       series("low", t.low),
+		Close:     series("close", t.close),
+		BBH:       indicator("bbh", t.bbh),
+		BBM:       indicator("bbm", t.bbm),
+		BBL:       indicator("bbl", t.bbl),
+		StochK:    indicator("stochk", t.stochK),
+		StochD:    indicator("stochd", t.stochD),
+		MFI:       indicator("mfi", t.mfi),
+		SMA:       indicator("sma", t.sma),
+		ADX:       indicator("adx", t.adx),
+		BuyPrice:  t.buyPrice,
+		defined:   defined,
+	}
+	copy(ret.Timestamp, t.timestamp[lo:hi])
+	return ret
+}
+
+// chartEpoch tells revisions of earlier runs apart, they restart from zero
+var chartEpoch = time.Now().Unix()
+
+// GetChartETag identifies the chart data by its last candle and the ticker's revision, as bar
+// updates and buy price changes keep the last timestamp
+func (s *Storage) GetChartETag(symbol string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tickers[symbol]
+	if !ok {
+		return "", false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	last := int64(0)
+	if len(t.timestamp) > 0 {
+		last = t.timestamp[len(t.timestamp)-1].Unix()
+	}
+	return fmt.Sprintf(`"%d-%d-%d"`, last, chartEpoch, t.revision), true
+}
+
+// ChartPoint is the last entry of every ChartData series, indicators without enough data are NaN
+type ChartPoint struct {
+	Timestamp time.Time
+	Open      float64
+	High      float64
+	Low       float64
+	Close     float64
+	BBH       float64
+	BBM       float64
+	BBL       float64
+	StochK    float64
+	StochD    float64
+	MFI       float64
+	SMA       float64
+	ADX       float64
+	BuyPrice  float64
+}
+
+// GetChartPoint returns the latest candle and its indicators, earlier values do not change with new candles
+func (s *Storage) GetChartPoint(symbol string) (ChartPoint, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tickers[symbol]
+	if !ok {
+		return ChartPoint{}, false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	i := len(t.timestamp) - 1
+	if i < 0 {
+		return ChartPoint{}, false
+	}
+	// Indicators are NaN until there is enough data
+	at := func(field string, values []float64) float64 {
+		if indicatorDefined(field, values, i) {
+			return values[i]
+		}
+		return math.NaN()
+	}
+	return ChartPoint{
+		Timestamp: t.timestamp[i],
+		Open:      t.open[i],
+		High:      t.high[i],
+		Low:       t.low[i],
+		Close:     t.close[i],
+		BBH:       at("bbh", t.bbh),
+		BBM:       at("bbm", t.bbm),
+		BBL:       at("bbl", t.bbl),
+		StochK:    at("stochk", t.stochK),
+		StochD:    at("stochd", t.stochD),
+		MFI:       at("mfi", t.mfi),
+		SMA:       at("sma", t.sma),
+		ADX:       at("adx", t.adx),
 		BuyPrice:  t.buyPrice,
+	}, true
+}
+
+func (s *Storage) GetExportRows(symbol string) []ExportRow {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tickers[symbol]
+	if !ok {
+		return nil
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	// Indicators are undefined before their lookback
+	at := func(field string, values []float64, i int) *float64 {
+		if indicatorDefined(field, values, i) {
+			return &values[i]
+		}
+		return nil
+	}
+	ret := make([]ExportRow, len(t.timestamp))
+	for i := range t.timestamp {
+		ret[i] = ExportRow{
+			Timestamp:  t.timestamp[i],
+			Open:       t.open[i],
+			High:       t.high[i],
+			Low:        t.low[i],
+			Close:      t.close[i],
+			Volume:     t.volume[i],
+			SMA:        at("sma", t.sma, i),
+			RSI:        at("rsi", t.rsi, i),
+			MACD:       at("macd", t.macd, i),
+			MACDSignal: at("macdsignal", t.macdSignal, i),
+			MACDHist:   at("macdhist", t.macdHist, i),
+			BBH:        at("bbh", t.bbh, i),
+			BBM:        at("bbm", t.bbm, i),
+			BBL:        at("bbl", t.bbl, i),
+			StochK:     at("stochk", t.stochK, i),
+			StochD:     at("stochd", t.stochD, i),
+			MFI:        at("mfi", t.mfi, i),
+			ADX:        at("adx", t.adx, i),
+		}
 	}
-	copy(ret.Timestamp, t.timestamp)
-	copy(ret.Open, t.open)
-	copy(ret.High, t.high)
-	copy(ret.Low, t.low)
-	copy(ret.Close, t.close)
-	copy(ret.BBH, t.bbh)
-	copy(ret.BBM, t.bbm)
-	copy(ret.BBL, t.bbl)
-	copy(ret.StochK, t.stochK)
-	copy(ret.StochD, t.stochD)
-	copy(ret.MFI, t.mfi)
-	copy(ret.ADX, t.adx)
-	copy(ret.SMA, t.sma)
 	return ret
 }
 
 type TickerTable struct {
-	Symbol   string
-	BuyPrice float64
-	Close    float64
-	Change   float64
-	Signal   Signal
+	Symbol     string
+	BuyPrice   float64
+	Close      float64
+	Change     float64
+	Signal     Signal
+	MutedUntil *time.Time `json:",omitempty"` // Of the room's watchlist, see GetRoomTickerRow
 }
 
 func (s *Storage) GetTickerTable() []TickerTable {
@@ -148,27 +433,24 @@ func (s *Storage) GetTickerTable() []TickerTable {
 	defer s.mu.RUnlock()
 	ret := make([]TickerTable, 0, len(s.tickers))
 
-	for s, t := range s.tickers {
-		t.mu.RLock()
-		defer t.mu.RUnlock()
-		change := 0.0
-		if t.buyPrice > 0 {
-			change = t.close[len(t.close)-1]/t.buyPrice*100 - 100
-		}
-		if len(t.close) == 0 {
-			continue
+	for _, t := range s.tickers {
+		if row, ok := t.row(); ok {
+			ret = append(ret, row)
 		}
-		ret = append(ret, TickerTable{
-			Symbol:   s,
-			BuyPrice: t.buyPrice,
-			Close:    t.close[len(t.close)-1],
-			Change:   change,
-			Signal:   t.signal,
-		})
 	}
 	return ret
 }
 
+func (s *Storage) GetTickerRow(symbol string) (TickerTable, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tickers[symbol]
+	if !ok {
+		return TickerTable{}, false
+	}
+	return t.row()
+}
+
 func (s *Storage) GetAllClose(symbol string) []float64 {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -225,6 +507,36 @@ func (s *Storage) GetChange(symbol string) float64 {
 	return t.close[len(t.close)-1]/t.buyPrice*100 - 100
 }
 
+func (s *Storage) GetDayChange(symbol string) float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tickers[symbol]
+	if !ok {
+		return math.NaN()
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if len(t.close) < 2 || t.close[len(t.close)-2] == 0 {
+		return math.NaN()
+	}
+	return t.close[len(t.close)-1]/t.close[len(t.close)-2]*100 - 100
+}
+
+func (s *Storage) GetPeriodChange(symbol string, days int) float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tickers[symbol]
+	if !ok {
+		return math.NaN()
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if len(t.close) <= days || t.close[len(t.close)-1-days] == 0 {
+		return math.NaN()
+	}
+	return t.close[len(t.close)-1]/t.close[len(t.close)-1-days]*100 - 100
+}
+
 func (s *Storage) GetBuyPrice(symbol string) float64 {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -339,27 +651,60 @@ func (s *Storage) GetSymbols() []string {
 }
 
 func (s *Storage) save() error {
-	if s.f == nil {
+	if s.filename == "" {
 		return nil
 	}
-	d := map[string]float64{}
-	for k, v := range s.tickers {
-		d[k] = v.buyPrice
-	}
-	if _, err := s.f.Seek(0, 0); err != nil {
+	buf, err := json.Marshal(s.tickers)
+	if err != nil {
 		return err
 	}
-	if err := s.f.Truncate(0); err != nil {
+	return writeFile(s.filename, buf)
+}
+
+// writeFile replaces the file through a temporary one, so a crash leaves the old or the new content
+func writeFile(filename string, buf []byte) error {
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0644); err != nil {
 		return err
 	}
-	return json.NewEncoder(s.f).Encode(s.tickers)
+	return os.Rename(tmp, filename)
 }
 
 func (s *Storage) load() error {
-	if s.f == nil {
+	s.tickers = map[string]*Ticker{}
+	buf, err := os.ReadFile(s.filename)
+	if os.IsNotExist(err) {
 		return nil
+	} else if err != nil {
+		return err
+	}
+	json.Unmarshal(buf, &s.tickers)
+	for k, v := range s.tickers {
+		v.symbol = k
+	}
+	return nil
+}
+
+func (s *Storage) historyFilename(symbol string) string {
+	return filepath.Join(s.historyDir, symbol+".csv")
+}
+
+func (s *Storage) loadHistory() error {
+	for symbol, t := range s.tickers {
+		f, err := os.Open(s.historyFilename(symbol))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		candles, err := ParseCandles(f)
+		f.Close()
+		if err != nil {
+			log.Printf("Failed to load history for %s: %v", symbol, err)
+			continue
+		}
+		// History files are written by imports only
+		t.Import(candles...)
 	}
-	s.tickers = map[string]*Ticker{}
-	json.NewDecoder(s.f).Decode(&s.tickers)
 	return nil
 }
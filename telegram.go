@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TELEGRAM_API_URL      = "https://api.telegram.org"
+	TELEGRAM_POLL_TIMEOUT = 30 // seconds
+)
+
+type TelegramBot struct {
+	startTime time.Time
+	apiURL    string
+	token     string
+	chatId    int64
+	client    *http.Client
+	msg       chan Message
+}
+
+type telegramResponse struct {
+	Ok          bool            `json:"ok"`
+	Description string          `json:"description"`
+	Result      json.RawMessage `json:"result"`
+}
+
+type telegramUpdate struct {
+	UpdateId int64 `json:"update_id"`
+	Message  *struct {
+		Date int64  `json:"date"`
+		Text string `json:"text"`
+		Chat struct {
+			Id int64 `json:"id"`
+		} `json:"chat"`
+		From struct {
+			Id int64 `json:"id"`
+		} `json:"from"`
+	} `json:"message"`
+}
+
+func NewTelegramBot(apiURL string, token string, chatId string) (*TelegramBot, error) {
+	id, err := strconv.ParseInt(chatId, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid chat ID: %v", err)
+	}
+	if apiURL == "" {
+		apiURL = TELEGRAM_API_URL
+	}
+	return &TelegramBot{
+		startTime: time.Now(),
+		apiURL:    strings.TrimRight(apiURL, "/"),
+		token:     token,
+		chatId:    id,
+		client:    &http.Client{Timeout: (TELEGRAM_POLL_TIMEOUT + 10) * time.Second},
+		msg:       make(chan Message, 100),
+	}, nil
+}
+
+func (b *TelegramBot) call(ctx context.Context, method string, contentType string, body io.Reader, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.apiURL+"/bot"+b.token+"/"+method, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	r := telegramResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("%s: HTTP %d", method, resp.StatusCode)
+	}
+	if !r.Ok {
+		return fmt.Errorf("%s: %s", method, r.Description)
+	}
+	if result != nil {
+		return json.Unmarshal(r.Result, result)
+	}
+	return nil
+}
+
+func (b *TelegramBot) callJSON(ctx context.Context, method string, params any, result any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return b.call(ctx, method, "application/json", bytes.NewReader(body), result)
+}
+
+func (b *TelegramBot) Run(ctx context.Context) error {
+	offset := int64(0)
+	for {
+		updates := []telegramUpdate{}
+		err := b.callJSON(ctx, "getUpdates", map[string]any{
+			"offset":          offset,
+			"timeout":         TELEGRAM_POLL_TIMEOUT,
+			"allowed_updates": []string{"message"},
+		}, &updates)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			// Back off and keep polling on transient errors
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+		for _, u := range updates {
+			offset = u.UpdateId + 1
+			if u.Message == nil || u.Message.Chat.Id != b.chatId {
+				continue
+			}
+			if u.Message.Date < b.startTime.Unix() {
+				continue
+			}
+			b.msg <- Message{Sender: "telegram:" + strconv.FormatInt(u.Message.From.Id, 10), Body: u.Message.Text}
+		}
+	}
+}
+
+func (b *TelegramBot) Message() <-chan Message {
+	return b.msg
+}
+
+// Room is not supported, only the configured chat is served
+func (b *TelegramBot) Room(room string) (Notifier, bool) {
+	return nil, false
+}
+
+func (b *TelegramBot) SendText(msg string) error {
+	return b.callJSON(context.Background(), "sendMessage", map[string]any{
+		"chat_id": b.chatId,
+		"text":    msg,
+	}, nil)
+}
+
+func (b *TelegramBot) SendCode(msg string) error {
+	return b.callJSON(context.Background(), "sendMessage", map[string]any{
+		"chat_id":    b.chatId,
+		"text":       "<pre>" + html.EscapeString(msg) + "</pre>",
+		"parse_mode": "HTML",
+	}, nil)
+}
+
+func (b *TelegramBot) SendHtml(text string, html string) error {
+	return b.SendText(text)
+}
+
+func (b *TelegramBot) SendTable(table Table) error {
+	return b.SendCode(renderTable(table))
+}
+
+func (b *TelegramBot) upload(method string, field string, buf []byte, filename string) error {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	w.WriteField("chat_id", strconv.FormatInt(b.chatId, 10))
+	part, err := w.CreateFormFile(field, filename)
+	if err != nil {
+		return err
+	}
+	part.Write(buf)
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return b.call(context.Background(), method, w.FormDataContentType(), body, nil)
+}
+
+func (b *TelegramBot) Thread(thread string) Notifier {
+	return b
+}
+
+func (b *TelegramBot) SendDashboard(dashboardId string, table Table) (string, error) {
+	return "", errDashboardUnsupported
+}
+
+func (b *TelegramBot) SendSignal(signal Signal, symbol string, price float64, msg string) error {
+	return b.SendText(msg)
+}
+
+func (b *TelegramBot) SendImage(buf []byte, contentType string, filename string) error {
+	return b.upload("sendPhoto", "photo", buf, filename)
+}
+
+func (b *TelegramBot) SendFile(buf []byte, contentType string, filename string) error {
+	return b.upload("sendDocument", "document", buf, filename)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTelegramSend(t *testing.T) {
+	requests := []map[string]any{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bottoken/sendMessage":
+			req := map[string]any{}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Error(err)
+			}
+			requests = append(requests, req)
+			w.Write([]byte(`{"ok": true, "result": {}}`))
+		case "/bottoken/sendDocument":
+			if r.FormValue("chat_id") != "42" {
+				t.Errorf("chat_id = %q", r.FormValue("chat_id"))
+			}
+			f, h, err := r.FormFile("document")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			buf, _ := io.ReadAll(f)
+			if h.Filename != "AAPL.csv" || string(buf) != "a,b\n" {
+				t.Errorf("Got file %s: %q", h.Filename, buf)
+			}
+			w.Write([]byte(`{"ok": true, "result": {}}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok": false, "description": "Bad Request: chat not found"}`))
+		}
+	}))
+	defer srv.Close()
+
+	b, err := NewTelegramBot(srv.URL+"/", "token", "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SendText("buy AAPL"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SendCode("a < b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SendFile([]byte("a,b\n"), "text/csv", "AAPL.csv"); err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]any{
+		{"chat_id": 42.0, "text": "buy AAPL"},
+		{"chat_id": 42.0, "text": "<pre>a &lt; b</pre>", "parse_mode": "HTML"},
+	}
+	if len(requests) != len(want) {
+		t.Fatalf("Got %d messages, want %d", len(requests), len(want))
+	}
+	for i := range want {
+		for k, v := range want[i] {
+			if requests[i][k] != v {
+				t.Errorf("Message %d %s = %v, want %v", i, k, requests[i][k], v)
+			}
+		}
+	}
+	if err := b.SendImage([]byte{}, "image/png", "chart.png"); err == nil || err.Error() != "sendPhoto: Bad Request: chat not found" {
+		t.Errorf("Got error %v", err)
+	}
+}
+
+func TestTelegramPoll(t *testing.T) {
+	now := time.Now().Unix()
+	mu := sync.Mutex{}
+	offsets := []float64{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := map[string]any{}
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		offsets = append(offsets, req["offset"].(float64))
+		first := len(offsets) == 1
+		mu.Unlock()
+		if !first {
+			// Long poll without updates
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte(`{"ok": true, "result": [
+			{"update_id": 10, "message": {"date": ` + strconv.FormatInt(now-3600, 10) + `, "text": "old", "chat": {"id": 42}, "from": {"id": 1}}},
+			{"update_id": 11, "message": {"date": ` + strconv.FormatInt(now+1, 10) + `, "text": "other chat", "chat": {"id": 7}, "from": {"id": 1}}},
+			{"update_id": 12},
+			{"update_id": 13, "message": {"date": ` + strconv.FormatInt(now+1, 10) + `, "text": "quote AAPL", "chat": {"id": 42}, "from": {"id": 5}}}
+		]}`))
+	}))
+	defer srv.Close()
+
+	b, err := NewTelegramBot(srv.URL, "token", "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- b.Run(ctx) }()
+
+	select {
+	case msg := <-b.Message():
+		if msg.Sender != "telegram:5" || msg.Body != "quote AAPL" {
+			t.Errorf("Got message %+v", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No message received")
+	}
+	// The next poll confirms the updates
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		mu.Lock()
+		n := len(offsets)
+		mu.Unlock()
+		if n >= 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run returned %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(offsets) < 2 || offsets[0] != 0 || offsets[1] != 14 {
+		t.Errorf("Got offsets %v, want [0 14]", offsets)
+	}
+	select {
+	case msg := <-b.Message():
+		t.Errorf("Unexpected message %+v", msg)
+	default:
+	}
+}
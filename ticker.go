@@ -11,9 +11,14 @@ import (
 )
 
 const (
-	KEEP = 500
+	KEEP      = 500 // candles in memory by default, about two years of daily bars
+	KEEP_NEWS = 100
 )
 
+// keepCandles is the number of candles kept in memory per ticker, see KEEP_CANDLES. Tickers
+// with imported history keep it all, see Ticker.Import.
+var keepCandles = KEEP
+
 type Candle struct {
 	Timestamp time.Time
 	Open      float64
@@ -23,6 +28,16 @@ type Candle struct {
 	Volume    float64
 }
 
+type News struct {
+	ID        int
+	CreatedAt time.Time
+	Author    string
+	Headline  string
+	Summary   string
+	URL       string
+	Symbols   []string
+}
+
 type Ticker struct {
 	mu sync.RWMutex
 
@@ -49,7 +64,13 @@ type Ticker struct {
 	mfi        []float64
 	adx        []float64
 
+	news []News
+	// importedFrom is the first imported candle, candles since are kept beyond keepCandles
+	importedFrom time.Time
+
 	signal Signal
+	// revision counts changes, bar updates keep the timestamp of the last candle
+	revision int
 }
 
 func NewTicker(symbol string, buyPrice float64) *Ticker {
@@ -74,18 +95,46 @@ func NewTicker(symbol string, buyPrice float64) *Ticker {
 		adx:        []float64{},
 		stochK:     []float64{},
 		stochD:     []float64{},
+		news:       []News{},
 		signal:     SignalHold,
 	}
 }
 
+// indicatorLookback is the number of candles before the first value of each indicator of calc
+var indicatorLookback = map[string]int{
+	"sma":        199, // SMA 200
+	"rsi":        14,
+	"macd":       33, // MACD 12, 26, 9, talib's partial signal values before are skipped
+	"macdsignal": 33,
+	"macdhist":   33,
+	"bbh":        49, // Bollinger Bands 50
+	"bbm":        49,
+	"bbl":        49,
+	"stochk":     17, // Stochastic 14, 3, 3
+	"stochd":     17,
+	"mfi":        14,
+	"adx":        27, // Twice the period
+}
+
+// indicatorDefined reports whether the indicator has a value at the index, zeros are valid values
+func indicatorDefined(field string, values []float64, i int) bool {
+	return i >= indicatorLookback[field] && i < len(values)
+}
+
 func (t *Ticker) calc() Signal {
 	if len(t.close) < 30 {
 		return SignalHold
 	}
-	t.sma = talib.Sma(t.close, 200)
+	// talib panics on fewer candles than the period, such indicators stay empty until then
+	t.sma, t.bbh, t.bbm, t.bbl = nil, nil, nil, nil
+	if len(t.close) > indicatorLookback["sma"] {
+		t.sma = talib.Sma(t.close, 200)
+	}
 	t.rsi = talib.Rsi(t.close, 14)
 	t.macd, t.macdSignal, t.macdHist = talib.Macd(t.close, 12, 26, 9)
-	t.bbh, t.bbm, t.bbl = talib.BBands(t.close, 50, 2.5, 2.5, talib.SMA)
+	if len(t.close) > indicatorLookback["bbh"] {
+		t.bbh, t.bbm, t.bbl = talib.BBands(t.close, 50, 2.5, 2.5, talib.SMA)
+	}
 	t.stochK, t.stochD = talib.Stoch(t.high, t.low, t.close, 14, 3, talib.SMA, 3, talib.SMA)
 	t.mfi = talib.Mfi(t.high, t.low, t.close, t.volume, 14)
 	t.adx = talib.Adx(t.high, t.low, t.close, 14)
@@ -93,8 +142,8 @@ func (t *Ticker) calc() Signal {
 
 	i := len(t.close) - 1
 
-	// Not enough data
-	if t.bbh[i] == 0 || t.bbl[i] == 0 || t.close[i] == 0 || t.stochD[i] == 0 || t.stochK[i] == 0 {
+	// Not enough data, the Bollinger Bands have the longest lookback of the indicators used
+	if !indicatorDefined("bbh", t.bbh, i) || t.close[i] == 0 {
 		return SignalHold
 	}
 
@@ -140,11 +189,69 @@ func (t *Ticker) Insert(candle ...Candle) Signal {
 			t.volume = slices.Insert(t.volume, n, c.Volume)
 		}
 	}
-	t.keep(KEEP)
+	t.keep(keepCandles)
+	t.revision++
 	return t.calc()
 }
 
+// Import inserts imported history, which is kept in memory, so indicators and backtests see it
+func (t *Ticker) Import(candles ...Candle) Signal {
+	t.mu.Lock()
+	for _, c := range candles {
+		if t.importedFrom.IsZero() || c.Timestamp.Before(t.importedFrom) {
+			t.importedFrom = c.Timestamp
+		}
+	}
+	t.mu.Unlock()
+	return t.Insert(candles...)
+}
+
+func (t *Ticker) Candles() []Candle {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	candles := make([]Candle, len(t.timestamp))
+	for k := range t.timestamp {
+		candles[k] = Candle{
+			Timestamp: t.timestamp[k],
+			Open:      t.open[k],
+			High:      t.high[k],
+			Low:       t.low[k],
+			Close:     t.close[k],
+			Volume:    t.volume[k],
+		}
+	}
+	return candles
+}
+
+// InsertNews adds articles ordered by creation time and returns the ones not seen before
+func (t *Ticker) InsertNews(news ...News) []News {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	added := []News{}
+	for _, n := range news {
+		if slices.ContainsFunc(t.news, func(v News) bool { return v.ID == n.ID }) {
+			continue
+		}
+		i, _ := slices.BinarySearchFunc(t.news, n.CreatedAt, func(a News, b time.Time) int {
+			return a.CreatedAt.Compare(b)
+		})
+		t.news = slices.Insert(t.news, i, n)
+		added = append(added, n)
+	}
+	if len(t.news) > KEEP_NEWS {
+		t.news = t.news[len(t.news)-KEEP_NEWS:]
+	}
+	return added
+}
+
 func (t *Ticker) keep(number int) {
+	if !t.importedFrom.IsZero() {
+		n, _ := slices.BinarySearchFunc(t.timestamp, t.importedFrom, func(a, b time.Time) int {
+			return cmp.Compare(a.Unix(), b.Unix())
+		})
+		number = max(number, len(t.timestamp)-n)
+	}
 	if len(t.timestamp) > number {
 		t.timestamp = t.timestamp[len(t.timestamp)-number:]
 		t.open = t.open[len(t.open)-number:]
@@ -155,6 +262,25 @@ func (t *Ticker) keep(number int) {
 	}
 }
 
+func (t *Ticker) row() (TickerTable, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if len(t.close) == 0 {
+		return TickerTable{}, false
+	}
+	change := 0.0
+	if t.buyPrice > 0 {
+		change = t.close[len(t.close)-1]/t.buyPrice*100 - 100
+	}
+	return TickerTable{
+		Symbol:   t.symbol,
+		BuyPrice: t.buyPrice,
+		Close:    t.close[len(t.close)-1],
+		Change:   change,
+		Signal:   t.signal,
+	}, true
+}
+
 type Signal string
 
 const (
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// DEFAULT_ROOM is the watchlist of the configured room of every chat backend
+const DEFAULT_ROOM = ""
+
+// Watch adds the symbol to the room's watchlist and reports whether the ticker is new,
+// in which case the caller fetches its history and subscribes to market data
+func (s *Storage) Watch(room string, symbol string, buyPrice float64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tickers[symbol]
+	if !ok {
+		t = NewTicker(symbol, 0)
+		s.tickers[symbol] = t
+	}
+	if room == DEFAULT_ROOM {
+		t.mu.Lock()
+		t.buyPrice = buyPrice
+		t.revision++
+		t.mu.Unlock()
+	}
+	if s.watchlists[room] == nil {
+		s.watchlists[room] = map[string]float64{}
+	}
+	s.watchlists[room][symbol] = buyPrice
+	if err := s.save(); err != nil {
+		return !ok, err
+	}
+	return !ok, s.saveWatchlists()
+}
+
+// Unwatch removes the symbol from the room's watchlist and reports whether no watchlist
+// references it anymore, in which case the ticker is dropped and the caller unsubscribes
+func (s *Storage) Unwatch(room string, symbol string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.watchlists[room][symbol]; !ok {
+		return false, fmt.Errorf("Unknown symbol %s", symbol)
+	}
+	delete(s.watchlists[room], symbol)
+	if len(s.watchlists[room]) == 0 {
+		delete(s.watchlists, room)
+	}
+	if err := s.saveWatchlists(); err != nil {
+		return false, err
+	}
+	if t, ok := s.tickers[symbol]; ok && room == DEFAULT_ROOM {
+		t.mu.Lock()
+		t.buyPrice = 0
+		t.revision++
+		t.mu.Unlock()
+	}
+	if len(s.watchers(symbol)) > 0 {
+		return false, s.save()
+	}
+	delete(s.tickers, symbol)
+	if s.historyDir != "" {
+		os.Remove(s.historyFilename(symbol))
+	}
+	return true, s.save()
+}
+
+func (s *Storage) IsWatched(room string, symbol string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.watchlists[room][symbol]
+	return ok
+}
+
+// GetWatchlist returns the sorted symbols of the room's watchlist
+func (s *Storage) GetWatchlist(room string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	symbols := make([]string, 0, len(s.watchlists[room]))
+	for k := range s.watchlists[room] {
+		symbols = append(symbols, k)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// GetWatchers returns the rooms watching the symbol
+func (s *Storage) GetWatchers(symbol string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.watchers(symbol)
+}
+
+func (s *Storage) watchers(symbol string) []string {
+	rooms := []string{}
+	for room, symbols := range s.watchlists {
+		if _, ok := symbols[symbol]; ok {
+			rooms = append(rooms, room)
+		}
+	}
+	sort.Strings(rooms)
+	return rooms
+}
+
+func (s *Storage) GetRoomBuyPrice(room string, symbol string) float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	buyPrice, ok := s.watchlists[room][symbol]
+	if !ok {
+		return math.NaN()
+	}
+	return buyPrice
+}
+
+// GetRoomChange returns the change from the buy price of the room's watchlist
+func (s *Storage) GetRoomChange(room string, symbol string) float64 {
+	buyPrice := s.GetRoomBuyPrice(room, symbol)
+	close := s.GetClose(symbol)
+	if math.IsNaN(buyPrice) || buyPrice == 0 || math.IsNaN(close) {
+		return math.NaN()
+	}
+	return close/buyPrice*100 - 100
+}
+
+// GetRoomTickerRow returns the ticker's row with the buy price and change of the room's watchlist
+func (s *Storage) GetRoomTickerRow(room string, symbol string) (TickerTable, bool) {
+	buyPrice := s.GetRoomBuyPrice(room, symbol)
+	row, ok := s.GetTickerRow(symbol)
+	if math.IsNaN(buyPrice) || !ok {
+		return TickerTable{}, false
+	}
+	row.BuyPrice = buyPrice
+	row.Change = 0
+	if buyPrice > 0 {
+		row.Change = row.Close/buyPrice*100 - 100
+	}
+	if until := s.GetMutedUntil(room, symbol); !until.IsZero() {
+		row.MutedUntil = &until
+	}
+	return row, true
+}
+
+// GetRoomTickerTable returns the rows of the room's watchlist sorted by symbol, see GetRoomTickerRow
+func (s *Storage) GetRoomTickerTable(room string) []TickerTable {
+	ret := []TickerTable{}
+	for _, symbol := range s.GetWatchlist(room) {
+		if row, ok := s.GetRoomTickerRow(room, symbol); ok {
+			ret = append(ret, row)
+		}
+	}
+	return ret
+}
+
+func (s *Storage) saveWatchlists() error {
+	if s.watchlistFilename == "" {
+		return nil
+	}
+	buf, err := json.Marshal(s.watchlists)
+	if err != nil {
+		return err
+	}
+	return writeFile(s.watchlistFilename, buf)
+}
+
+// loadWatchlists reads the watchlists and puts tickers not watched by any room,
+// e.g. from before watchlists existed, into the default room
+func (s *Storage) loadWatchlists() error {
+	s.watchlists = map[string]map[string]float64{}
+	buf, err := os.ReadFile(s.watchlistFilename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(buf) > 0 {
+		if err := json.Unmarshal(buf, &s.watchlists); err != nil {
+			return err
+		}
+	}
+	for symbol, t := range s.tickers {
+		if len(s.watchers(symbol)) > 0 {
+			continue
+		}
+		if s.watchlists[DEFAULT_ROOM] == nil {
+			s.watchlists[DEFAULT_ROOM] = map[string]float64{}
+		}
+		s.watchlists[DEFAULT_ROOM][symbol] = t.buyPrice
+	}
+	// Drop entries of tickers that are gone
+	for room, symbols := range s.watchlists {
+		for symbol := range symbols {
+			if _, ok := s.tickers[symbol]; !ok {
+				delete(symbols, symbol)
+			}
+		}
+		if len(symbols) == 0 {
+			delete(s.watchlists, room)
+		}
+	}
+	return s.saveWatchlists()
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	WEBHOOK_RETRIES = 5
+	WEBHOOK_BACKOFF = 2 * time.Second
+	WEBHOOK_QUEUE   = 100
+)
+
+type WebhookEventType string
+
+const (
+	WebhookSignal WebhookEventType = "signal"
+	WebhookNews   WebhookEventType = "news"
+	// WebhookFill is a buy price recorded with add or the API, robotrader places no orders itself
+	WebhookFill WebhookEventType = "fill"
+)
+
+type WebhookEvent struct {
+	Event     WebhookEventType
+	Time      time.Time
+	Timestamp time.Time
+	Room      string `json:",omitempty"` // Watchlist of the buy price and change of fills and signals
+	TickerTable
+	News *News `json:",omitempty"`
+}
+
+// webhookError is a response other than 2xx, only rate limits and server errors are retried
+type webhookError struct {
+	status int
+}
+
+func (e *webhookError) Error() string {
+	return fmt.Sprintf("HTTP %d", e.status)
+}
+
+func (e *webhookError) retryable() bool {
+	return e.status == http.StatusTooManyRequests || e.status >= http.StatusInternalServerError
+}
+
+type webhookTarget struct {
+	url   string
+	queue chan []byte
+}
+
+// Webhooks posts events as signed JSON to every configured URL
+type Webhooks struct {
+	targets    []*webhookTarget
+	secret     []byte
+	deadLetter string
+	client     *http.Client
+	mu         sync.Mutex
+}
+
+func NewWebhooks(urls []string, secret string, deadLetter string) *Webhooks {
+	w := &Webhooks{
+		secret:     []byte(secret),
+		deadLetter: deadLetter,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, u := range urls {
+		w.targets = append(w.targets, &webhookTarget{
+			url:   u,
+			queue: make(chan []byte, WEBHOOK_QUEUE),
+		})
+	}
+	return w
+}
+
+func (w *Webhooks) Run(ctx context.Context) error {
+	wg := sync.WaitGroup{}
+	for _, t := range w.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Deliver in order, one event at a time per URL
+			for {
+				select {
+				case <-ctx.Done():
+					// Events queued at shutdown go to the dead-letter file instead of being lost
+					for {
+						select {
+						case payload := <-t.queue:
+							w.dead(t.url, payload, ctx.Err())
+						default:
+							return
+						}
+					}
+				case payload := <-t.queue:
+					if err := w.deliver(ctx, t.url, payload); err != nil {
+						w.dead(t.url, payload, err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (w *Webhooks) Send(evt WebhookEvent) {
+	if len(w.targets) == 0 {
+		return
+	}
+	evt.Time = time.Now()
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		return
+	}
+	for _, t := range w.targets {
+		select {
+		case t.queue <- payload:
+		default:
+			w.dead(t.url, payload, fmt.Errorf("Queue full"))
+		}
+	}
+}
+
+func (w *Webhooks) sign(payload []byte) string {
+	mac := hmac.New(sha256.New, w.secret)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *Webhooks) deliver(ctx context.Context, url string, payload []byte) error {
+	var err error
+	for attempt := 0; attempt <= WEBHOOK_RETRIES; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(WEBHOOK_BACKOFF << (attempt - 1)):
+			}
+		}
+		if err = w.post(ctx, url, payload); err == nil {
+			return nil
+		}
+		var httpErr *webhookError
+		if errors.As(err, &httpErr) && !httpErr.retryable() {
+			return err
+		}
+	}
+	return err
+}
+
+func (w *Webhooks) post(ctx context.Context, url string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.secret) > 0 {
+		req.Header.Set("X-Robotrader-Signature", w.sign(payload))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return &webhookError{status: resp.StatusCode}
+	}
+	return nil
+}
+
+// dead appends an undeliverable event to the dead-letter file as a JSON line
+func (w *Webhooks) dead(url string, payload []byte, cause error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// The event is lost if it can't be written, leave a trace of it at least
+	lost := func(err error) {
+		log.Printf("Failed to dead-letter webhook event of %d bytes for %s (%v): %v", len(payload), url, cause, err)
+	}
+	f, err := os.OpenFile(w.deadLetter, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		lost(err)
+		return
+	}
+	err = json.NewEncoder(f).Encode(struct {
+		Time    time.Time
+		URL     string
+		Error   string
+		Payload json.RawMessage
+	}{
+		Time:    time.Now(),
+		URL:     url,
+		Error:   cause.Error(),
+		Payload: payload,
+	})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		lost(err)
+	}
+}
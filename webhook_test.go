@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type deadLetter struct {
+	URL     string
+	Error   string
+	Payload WebhookEvent
+}
+
+func readDeadLetters(t *testing.T, filename string) []deadLetter {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ret := []deadLetter{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		d := deadLetter{}
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			t.Fatal(err)
+		}
+		ret = append(ret, d)
+	}
+	return ret
+}
+
+func TestWebhooksDeliver(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		calls    int32
+		dead     string
+	}{
+		{name: "ok", statuses: []int{http.StatusNoContent}, calls: 1},
+		{name: "rate limited", statuses: []int{http.StatusTooManyRequests, http.StatusOK}, calls: 2},
+		{name: "server error", statuses: []int{http.StatusBadGateway, http.StatusOK}, calls: 2},
+		{name: "client error", statuses: []int{http.StatusBadRequest, http.StatusOK}, calls: 1, dead: "HTTP 400"},
+		{name: "gone", statuses: []int{http.StatusGone, http.StatusOK}, calls: 1, dead: "HTTP 410"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := atomic.Int32{}
+			received := make(chan []byte, 10)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := calls.Add(1)
+				buf, _ := io.ReadAll(r.Body)
+				mac := (&Webhooks{secret: []byte("secret")}).sign(buf)
+				if r.Header.Get("X-Robotrader-Signature") != mac {
+					t.Errorf("Signature = %q, want %q", r.Header.Get("X-Robotrader-Signature"), mac)
+				}
+				w.WriteHeader(tt.statuses[n-1])
+				if tt.statuses[n-1] < http.StatusMultipleChoices {
+					received <- buf
+				}
+			}))
+			defer srv.Close()
+
+			deadFile := filepath.Join(t.TempDir(), "dead.jsonl")
+			w := NewWebhooks([]string{srv.URL}, "secret", deadFile)
+			err := w.deliver(context.Background(), srv.URL, []byte(`{"Event":"signal"}`))
+			if calls.Load() != tt.calls {
+				t.Errorf("Got %d calls, want %d", calls.Load(), tt.calls)
+			}
+			if tt.dead == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if buf := <-received; string(buf) != `{"Event":"signal"}` {
+					t.Errorf("Got payload %s", buf)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.dead {
+				t.Errorf("Got error %v, want %s", err, tt.dead)
+			}
+		})
+	}
+}
+
+func TestWebhooksDeadLetterOnShutdown(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	deadFile := filepath.Join(t.TempDir(), "dead.jsonl")
+	w := NewWebhooks([]string{srv.URL}, "", deadFile)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	for _, symbol := range []string{"AAPL", "MSFT", "NVDA"} {
+		w.Send(WebhookEvent{Event: WebhookFill, TickerTable: TickerTable{Symbol: symbol, BuyPrice: 100}})
+	}
+	// The first event is in flight, the others are queued
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return")
+	}
+
+	dead := readDeadLetters(t, deadFile)
+	if len(dead) != 3 {
+		t.Fatalf("Got %d dead letters, want 3: %+v", len(dead), dead)
+	}
+	for i, symbol := range []string{"AAPL", "MSFT", "NVDA"} {
+		if dead[i].URL != srv.URL || dead[i].Payload.Event != WebhookFill || dead[i].Payload.Symbol != symbol {
+			t.Errorf("Dead letter %d = %+v, want fill of %s", i, dead[i], symbol)
+		}
+	}
+}
+
+func TestWebhooksDeadLetterLost(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	w := NewWebhooks([]string{"http://example.com/hook"}, "", filepath.Join(t.TempDir(), "missing", "dead.jsonl"))
+	w.dead("http://example.com/hook", []byte(`{"Event":"signal"}`), errors.New("HTTP 400"))
+	if msg := buf.String(); !strings.Contains(msg, "18 bytes for http://example.com/hook (HTTP 400)") {
+		t.Errorf("Got log %q", msg)
+	}
+}